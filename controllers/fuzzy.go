@@ -1,15 +1,9 @@
 package controllers
 
-import "strings"
-
 // MatchesFuzzyRemove checks if the input expresses an intent to remove something.
+// Negated requests ("don't remove r/books") don't count, and "leave" only
+// does when it is aimed at a subreddit ("leave r/news", "leave the news
+// subs"), so "I'd like to leave it alone" is not a removal.
 func MatchesFuzzyRemove(input string) bool {
-	lc := strings.ToLower(input)
-	return strings.Contains(lc, "remove") ||
-		strings.Contains(lc, "delete") ||
-		strings.Contains(lc, "get rid of") ||
-		strings.Contains(lc, "unsub") ||
-		strings.Contains(lc, "leave") ||
-		strings.Contains(lc, "drop") ||
-		strings.Contains(lc, "no more")
+	return ParseSlots(input).Removal
 }
@@ -1,75 +1,218 @@
 package controllers
 
-import (
-	"strings"
+import "strings"
+
+// IntentType is the single label an input is classified as, shared by the
+// rule-based parser and the LLM classifier.
+type IntentType string
+
+const (
+	ShowSubs          IntentType = "show_subs"
+	ShowPlan          IntentType = "show_plan"
+	RegenerateAdds    IntentType = "regenerate_adds"
+	RegenerateRemoves IntentType = "regenerate_removes"
+	ClearRemoves      IntentType = "clear_removes"
+	NewPrompt         IntentType = "new_prompt"
+	RefineRemoves     IntentType = "refine_removes"
+	RemoveOnlyIntent  IntentType = "remove_only"
+	None              IntentType = "none"
 )
 
+// IntentTypes lists every valid IntentType.
+var IntentTypes = []IntentType{
+	ShowSubs, ShowPlan, RegenerateAdds, RegenerateRemoves, ClearRemoves,
+	NewPrompt, RefineRemoves, RemoveOnlyIntent, None,
+}
+
+// ConfidentIntent is the confidence at or above which a rule-based result is
+// trusted without asking the LLM.
+const ConfidentIntent = 0.7
+
 type Intent struct {
 	RegenerateAdds    bool
 	RegenerateRemoves bool
 	ClearRemoves      bool
 	NewTopicPrompt    string
 	ShowSubList       bool
+	ShowPlan          bool
 	RemoveMode        bool
-	FollowUpMore      bool // NEW
+	FollowUpMore      bool
 	RawFeedback       string
+
+	Type       IntentType
+	Confidence float64
+	Source     string // "rules" or "llm"
+	Slots      IntentSlots
+}
+
+// IntentSlots holds values extracted from the input by ParseSlots.
+// Subreddit names never carry the r/ prefix.
+type IntentSlots struct {
+	Subreddits         []string // every subreddit mentioned
+	AddSubreddits      []string // "add r/x"
+	RemoveSubreddits   []string // "remove r/x"
+	KeepSubreddits     []string // "keep r/x", "don't remove r/x"
+	ExcludedSubreddits []string // "skip r/x", "don't add r/x"
+	Topics             []string // "I'm into hiking" → hiking
+	RemoveTopics       []string // "get rid of news subs" → news
+	ExcludedTopics     []string // "not the anime ones" → anime
+	Count              int      // "5 more" → 5; zero when not given
+	Negated            bool     // the input contains a negation
+	Removal            bool     // a removal was asked for and not negated
+}
+
+// FeedbackOnly reports whether the input only keeps or excludes things
+// ("skip r/x", "don't remove r/books") without asking for anything new.
+func (s IntentSlots) FeedbackOnly() bool {
+	hasFeedback := len(s.KeepSubreddits) > 0 || len(s.ExcludedSubreddits) > 0 || len(s.ExcludedTopics) > 0
+	asksForMore := len(s.Topics) > 0 || len(s.AddSubreddits) > 0 || s.Removal
+	return hasFeedback && !asksForMore
 }
 
 // ParseConversationIntent examines the user input to determine their intent.
+// Confidence is lowered when the input matches no rule or several
+// conflicting ones, so callers can fall back to the LLM classifier.
 func ParseConversationIntent(input string) Intent {
-	lc := strings.ToLower(input)
-	intent := Intent{RawFeedback: input}
+	text := normalizeInput(input)
+	intent := Intent{RawFeedback: input, Source: "rules", Slots: ParseSlots(input)}
+
+	var matched []IntentType
+	switch {
+	case isOneOf(text, "show", "review", "summary", "show plan", "show my plan", "show the plan", "current plan", "show current plan"):
+		matched = append(matched, ShowPlan)
+	case isOneOf(text, "ok", "okay", "thanks", "thank you", "cool", "nice", "great", "got it", "sounds good"):
+		matched = append(matched, None)
+	}
 
 	// Match vague follow-up prompts like "give me more", "another one", "recommend more"
-	if containsAny(lc, []string{
-		"give me more", "more subs", "recommend more", "another one",
-		"more suggestions", "another suggestion", "more please",
-	}) {
-		intent.FollowUpMore = true
-		intent.RegenerateAdds = true
+	if hasAnyPhrase(text, "give me more", "more subs", "recommend more", "another one",
+		"more suggestions", "another suggestion", "more please", "suggest more") ||
+		(intent.Slots.Count > 0 && len(intent.Slots.Topics) == 0) {
+		matched = append(matched, RegenerateAdds)
 	}
 
 	// Regenerate removals
-	if strings.Contains(lc, "remove more") || strings.Contains(lc, "prune more") {
-		intent.RegenerateRemoves = true
+	if hasAnyPhrase(text, "remove more", "prune more") {
+		matched = append(matched, RegenerateRemoves)
 	}
 
 	// Clear removal suggestions
-	if strings.Contains(lc, "keep all") || strings.Contains(lc, "clear removes") {
-		intent.ClearRemoves = true
-	}
-
-	// New topic prompt
-	if strings.Contains(lc, "suggest more") && strings.Contains(lc, "subs") {
-		intent.NewTopicPrompt = input
+	if hasAnyPhrase(text, "keep all", "clear removes") {
+		matched = append(matched, ClearRemoves)
 	}
 
 	// Show current subscriptions
-	if containsAny(lc, []string{
-		"show subs", "show my subs", "show me my subs", "show subreddits",
+	if hasAnyPhrase(text, "show subs", "show my subs", "show me my subs", "show subreddits",
 		"show my subreddits", "show me my subreddits", "list my subs",
 		"list my subreddits", "what am i subscribed to", "what communities",
-		"what subreddits", "which ones do i follow", "subs i use",
-		"review", "summary",
-	}) {
-		intent.ShowSubList = true
+		"what subreddits", "which ones do i follow", "subs i use") {
+		matched = append(matched, ShowSubs)
 	}
 
 	// General fuzzy removal intent (we let GPT handle the category)
-	if containsAny(lc, []string{
-		"remove", "unsubscribe", "prune", "get rid", "delete", "i don't want",
-	}) {
-		intent.RemoveMode = true
-		intent.NewTopicPrompt = input // Forward full phrase to GPT
-		intent.RegenerateRemoves = true
+	if intent.Slots.Removal || hasAnyPhrase(text, "clean up") {
+		if hasAnyPhrase(text, "inactive", "dead", "clean up", "cleanup") {
+			matched = append(matched, RemoveOnlyIntent)
+		} else if !containsType(matched, RegenerateRemoves) {
+			matched = append(matched, RefineRemoves)
+		}
 	}
 
+	// Interest statements start a new topic
+	if len(matched) == 0 && (len(intent.Slots.Topics) > 0 || len(intent.Slots.AddSubreddits) > 0) {
+		matched = append(matched, NewPrompt)
+	}
+
+	// "skip r/x" or "don't remove r/books" only adjusts the current plan
+	if len(matched) == 0 && intent.Slots.FeedbackOnly() {
+		matched = append(matched, None)
+	}
+
+	switch {
+	case len(matched) == 1:
+		intent.ApplyType(matched[0])
+		intent.Confidence = 0.9
+		if matched[0] == NewPrompt {
+			intent.Confidence = 0.8
+		}
+	case len(matched) > 1:
+		// Conflicting signals: go with the first match but let the LLM decide.
+		intent.ApplyType(matched[0])
+		intent.Confidence = 0.4
+	default:
+		// Nothing matched. Treat it as a new topic, but it is ambiguous.
+		intent.ApplyType(NewPrompt)
+		intent.Confidence = 0.5
+	}
 	return intent
 }
 
-func containsAny(input string, keywords []string) bool {
-	for _, k := range keywords {
-		if strings.Contains(input, k) {
+// ApplyType sets the intent's type and the flags HandleRequest acts on.
+func (i *Intent) ApplyType(t IntentType) {
+	i.Type = t
+	i.RegenerateAdds, i.RegenerateRemoves, i.ClearRemoves = false, false, false
+	i.ShowSubList, i.ShowPlan, i.RemoveMode, i.FollowUpMore = false, false, false, false
+	i.NewTopicPrompt = ""
+
+	switch t {
+	case ShowSubs:
+		i.ShowSubList = true
+	case ShowPlan:
+		i.ShowPlan = true
+	case RegenerateAdds:
+		i.FollowUpMore = true
+		i.RegenerateAdds = true
+	case RegenerateRemoves, RefineRemoves, RemoveOnlyIntent:
+		i.RemoveMode = true
+		i.RegenerateRemoves = true
+		i.NewTopicPrompt = i.RawFeedback // Forward full phrase to GPT
+	case ClearRemoves:
+		i.ClearRemoves = true
+	case NewPrompt:
+		i.NewTopicPrompt = i.RawFeedback
+	}
+}
+
+// normalizeInput lowercases input and reduces punctuation to single spaces,
+// keeping apostrophes and r/ prefixes so phrases can be matched on word
+// boundaries.
+func normalizeInput(input string) string {
+	lc := strings.ToLower(input)
+	lc = strings.ReplaceAll(lc, "’", "'")
+	clean := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '\'', r == '/', r == '_':
+			return r
+		}
+		return ' '
+	}, lc)
+	return strings.Join(strings.Fields(clean), " ")
+}
+
+// hasAnyPhrase reports whether normalized text contains one of the phrases
+// as whole words.
+func hasAnyPhrase(text string, phrases ...string) bool {
+	padded := " " + text + " "
+	for _, p := range phrases {
+		if strings.Contains(padded, " "+p+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func isOneOf(text string, options ...string) bool {
+	for _, o := range options {
+		if text == o {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType(types []IntentType, t IntentType) bool {
+	for _, x := range types {
+		if x == t {
 			return true
 		}
 	}
@@ -1,11 +1,17 @@
 package controllers
 
 import (
+	"regexp"
 	"strings"
 
 	"github.com/HenryArin/ReddmeitAlpha/models"
 )
 
+var recommendationSubPattern = regexp.MustCompile(`r/[A-Za-z0-9_]+`)
+
+// ParseRecommendationOutput sorts the + / - / = lines of a model reply into
+// subreddits to add, remove and keep. Entries are bare "r/name" values; any
+// explanation after the name is dropped.
 func ParseRecommendationOutput(output string) models.Recommendation {
 	lines := strings.Split(output, "\n")
 	seen := make(map[string]bool)
@@ -14,26 +20,25 @@ func ParseRecommendationOutput(output string) models.Recommendation {
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
+		if len(line) < 2 {
+			continue
+		}
+		sub := recommendationSubPattern.FindString(strings.TrimSpace(line[1:]))
+		if sub == "" || !strings.HasPrefix(strings.TrimSpace(line[1:]), sub) || seen[strings.ToLower(sub)] {
+			continue
+		}
 
-		if strings.HasPrefix(line, "+ r/") {
-			sub := strings.TrimSpace(strings.TrimPrefix(line, "+ "))
-			if !seen[sub] {
-				rec.Add = append(rec.Add, sub)
-				seen[sub] = true
-			}
-		} else if strings.HasPrefix(line, "- r/") {
-			sub := strings.TrimSpace(strings.TrimPrefix(line, "- "))
-			if !seen[sub] {
-				rec.Remove = append(rec.Remove, sub)
-				seen[sub] = true
-			}
-		} else if strings.HasPrefix(line, "= r/") {
-			sub := strings.TrimSpace(strings.TrimPrefix(line, "= "))
-			if !seen[sub] {
-				rec.Keep = append(rec.Keep, sub)
-				seen[sub] = true
-			}
+		switch line[0] {
+		case '+':
+			rec.Add = append(rec.Add, sub)
+		case '-':
+			rec.Remove = append(rec.Remove, sub)
+		case '=':
+			rec.Keep = append(rec.Keep, sub)
+		default:
+			continue
 		}
+		seen[strings.ToLower(sub)] = true
 	}
 
 	return rec
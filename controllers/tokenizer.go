@@ -0,0 +1,391 @@
+package controllers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TokenKind classifies a token produced by Tokenize.
+type TokenKind int
+
+const (
+	WordToken      TokenKind = iota // a lowercased word, contractions kept whole
+	SubredditToken                  // r/name; Text holds the name without the prefix
+	QuotedToken                     // "..." or '...'; Text holds the raw contents
+	NumberToken                     // digits; Text holds the digits
+	CommaToken                      // list separator, does not end a clause
+	BoundaryToken                   // . ; ! ? which end a clause
+)
+
+// Token is one lexical unit of user input.
+type Token struct {
+	Kind TokenKind
+	Text string
+}
+
+var subredditNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,21}$`)
+
+// Tokenize splits input into words, r/ names, quoted strings, numbers and
+// punctuation. Curly quotes and apostrophes are treated like straight ones.
+func Tokenize(input string) []Token {
+	input = strings.NewReplacer("’", "'", "‘", "'", "“", `"`, "”", `"`).Replace(input)
+	runes := []rune(input)
+	var tokens []Token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || (r == '\'' && (i == 0 || !isWordRune(runes[i-1]))):
+			end := indexRune(runes, r, i+1)
+			if end < 0 {
+				i++ // unmatched quote, ignore it
+				continue
+			}
+			if text := strings.TrimSpace(string(runes[i+1 : end])); text != "" {
+				tokens = append(tokens, Token{Kind: QuotedToken, Text: text})
+			}
+			i = end + 1
+		case r == ',':
+			tokens = append(tokens, Token{Kind: CommaToken, Text: ","})
+			i++
+		case r == '.' || r == ';' || r == '!' || r == '?':
+			tokens = append(tokens, Token{Kind: BoundaryToken, Text: string(r)})
+			i++
+		case isWordRune(r) || r == '/':
+			start := i
+			for i < len(runes) && (isWordRune(runes[i]) || runes[i] == '/' || runes[i] == '\'') {
+				i++
+			}
+			word := strings.Trim(strings.ToLower(string(runes[start:i])), "'/")
+			if word == "" {
+				continue
+			}
+			tokens = append(tokens, classifyWord(word, string(runes[start:i])))
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+func classifyWord(lower, original string) Token {
+	if strings.HasPrefix(lower, "r/") {
+		name := strings.Trim(original[2:], "'/")
+		if subredditNamePattern.MatchString(name) {
+			return Token{Kind: SubredditToken, Text: name}
+		}
+	}
+	if _, err := strconv.Atoi(lower); err == nil {
+		return Token{Kind: NumberToken, Text: lower}
+	}
+	return Token{Kind: WordToken, Text: lower}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
+
+func indexRune(runes []rune, r rune, from int) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// action is what the current part of a sentence asks for.
+type action int
+
+const (
+	noAction action = iota
+	addAction
+	interestAction
+	removeAction
+	keepAction
+	excludeAction
+	wantAction // "want": an interest, or a removal when negated
+)
+
+var verbActions = map[string]action{
+	"add": addAction, "subscribe": addAction, "join": addAction, "include": addAction,
+	"recommend": addAction, "suggest": addAction, "find": addAction, "give": addAction,
+	"into": interestAction, "like": interestAction, "love": interestAction, "enjoy": interestAction,
+	"interested": interestAction, "about": interestAction, "looking": interestAction,
+	"want": wantAction, "need": wantAction,
+	"remove": removeAction, "delete": removeAction, "unsubscribe": removeAction, "drop": removeAction,
+	"prune": removeAction, "ditch": removeAction, "rid": removeAction, "cleanup": removeAction,
+	"keep": keepAction, "retain": keepAction, "protect": keepAction,
+	"skip": excludeAction, "exclude": excludeAction, "except": excludeAction, "without": excludeAction,
+	"avoid": excludeAction,
+}
+
+var negators = map[string]bool{
+	"not": true, "don't": true, "dont": true, "never": true, "doesn't": true, "doesnt": true,
+	"won't": true, "wont": true, "didn't": true, "didnt": true, "stop": true,
+}
+
+var numberWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7,
+	"eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12, "fifteen": 15, "twenty": 20,
+	"couple": 2, "few": 3,
+}
+
+var countNouns = map[string]bool{
+	"more": true, "subs": true, "subreddits": true, "suggestions": true, "communities": true,
+	"new": true, "other": true, "others": true, "extra": true,
+}
+
+// fillerWords never form part of a topic phrase.
+var fillerWords = map[string]bool{
+	"i": true, "i'm": true, "im": true, "i'd": true, "id": true, "me": true, "my": true, "mine": true,
+	"you": true, "your": true, "it": true, "its": true, "this": true, "that": true, "these": true,
+	"those": true, "them": true, "they": true, "we": true, "us": true, "our": true,
+	"a": true, "an": true, "the": true, "some": true, "any": true, "all": true, "more": true,
+	"sub": true, "subs": true, "subreddit": true, "subreddits": true, "community": true,
+	"communities": true, "ones": true, "one": true, "stuff": true, "things": true, "related": true,
+	"also": true, "just": true, "really": true, "maybe": true, "get": true, "go": true, "show": true,
+	"please": true, "thanks": true, "lot": true, "lots": true, "new": true, "other": true,
+	"others": true, "like": true, "do": true, "am": true, "kind": true, "sort": true,
+	"something": true, "anything": true, "very": true, "much": true, "many": true,
+	"ok": true, "okay": true, "yes": true, "no": true, "r": true, "let's": true, "lets": true,
+	"suggestions": true, "extra": true, "instead": true, "too": true, "either": true, "alone": true,
+	"leave": true, "into": true, "what": true, "which": true, "here": true, "there": true,
+}
+
+// ParseSlots walks the tokens of input and works out, clause by clause,
+// which subreddits and topics the user wants added, removed, kept or
+// excluded. Negation applies from the negating word to the end of the clause
+// (. ; ! ? or "but"), or until a new verb follows an object, so
+// "don't remove r/books but drop r/news" keeps r/books and removes r/news.
+func ParseSlots(input string) IntentSlots {
+	tokens := Tokenize(input)
+	var slots IntentSlots
+	p := slotParser{slots: &slots}
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.Kind {
+		case BoundaryToken:
+			p.flush()
+			p.reset()
+		case CommaToken:
+			p.flush()
+		case NumberToken:
+			p.flush()
+			if n, _ := strconv.Atoi(tok.Text); n > 0 && slots.Count == 0 && followsCountNoun(tokens, i) {
+				slots.Count = n
+			}
+		case SubredditToken:
+			p.flush()
+			p.mention(tok.Text)
+		case QuotedToken:
+			p.flush()
+			if name := strings.TrimPrefix(tok.Text, "r/"); subredditNamePattern.MatchString(name) {
+				p.mention(name)
+			} else {
+				p.topic = []string{strings.ToLower(tok.Text)}
+				p.flush()
+			}
+		case WordToken:
+			p.word(tokens, i)
+		}
+	}
+	p.flush()
+	return slots
+}
+
+type slotParser struct {
+	slots     *IntentSlots
+	act       action
+	negated   bool
+	sawObject bool
+	topic     []string
+}
+
+func (p *slotParser) reset() {
+	p.act, p.negated, p.sawObject = noAction, false, false
+}
+
+func (p *slotParser) word(tokens []Token, i int) {
+	w := tokens[i].Text
+	switch {
+	case w == "but":
+		p.flush()
+		p.reset()
+	case w == "and" || w == "or" || w == "&" || w == "nor":
+		p.flush()
+	case negators[w]:
+		p.flush()
+		p.negated = true
+		p.slots.Negated = true
+	case w == "no":
+		p.flush()
+		p.slots.Negated = true
+		if i+1 < len(tokens) && tokens[i+1].Text == "more" {
+			p.setAction(removeAction) // "no more anime"
+		} else {
+			p.setAction(excludeAction) // "no anime"
+		}
+	case w == "leave":
+		// Only "leave r/x" or "leave the x subs" is a removal.
+		p.flush()
+		if leavesSubreddit(tokens[i+1:]) {
+			p.setAction(removeAction)
+		}
+	case strings.HasPrefix(w, "unsub"):
+		p.flush()
+		p.setAction(removeAction)
+	case verbActions[w] != noAction:
+		p.flush()
+		p.setAction(verbActions[w])
+	case numberWords[w] > 0 && followsCountNoun(tokens, i):
+		p.flush()
+		if p.slots.Count == 0 {
+			p.slots.Count = numberWords[w]
+		}
+	case fillerWords[w] || isCommonWord(w) || len(w) < 2:
+		p.flush()
+	default:
+		p.topic = append(p.topic, w)
+	}
+}
+
+func (p *slotParser) setAction(a action) {
+	if p.sawObject {
+		// A new verb after an object starts a new clause: "don't remove
+		// r/books and add r/manga".
+		p.negated = false
+		p.sawObject = false
+	}
+	p.act = a
+	if p.effective() == removeAction {
+		// A removal verb signals removal even before its object.
+		p.slots.Removal = true
+	}
+}
+
+// effective resolves the current action against negation.
+func (p *slotParser) effective() action {
+	a := p.act
+	if a == wantAction {
+		if p.negated {
+			return removeAction // "I don't want news subs"
+		}
+		return interestAction
+	}
+	if !p.negated {
+		return a
+	}
+	switch a {
+	case addAction, interestAction, noAction:
+		return excludeAction
+	case removeAction:
+		return keepAction
+	case keepAction:
+		return removeAction
+	case excludeAction:
+		return addAction
+	}
+	return a
+}
+
+func (p *slotParser) mention(name string) {
+	p.sawObject = true
+	s := p.slots
+	s.Subreddits = appendUnique(s.Subreddits, name)
+	switch p.effective() {
+	case addAction:
+		s.AddSubreddits = appendUnique(s.AddSubreddits, name)
+	case removeAction:
+		s.RemoveSubreddits = appendUnique(s.RemoveSubreddits, name)
+		s.Removal = true
+	case keepAction:
+		s.KeepSubreddits = appendUnique(s.KeepSubreddits, name)
+	case excludeAction:
+		s.ExcludedSubreddits = appendUnique(s.ExcludedSubreddits, name)
+	}
+}
+
+func (p *slotParser) flush() {
+	if len(p.topic) == 0 {
+		return
+	}
+	phrase := strings.Join(p.topic, " ")
+	p.topic = nil
+	p.sawObject = true
+	s := p.slots
+	switch p.effective() {
+	case removeAction:
+		s.RemoveTopics = appendUnique(s.RemoveTopics, phrase)
+		s.Removal = true
+	case excludeAction:
+		s.ExcludedTopics = appendUnique(s.ExcludedTopics, phrase)
+	case keepAction:
+		// Keeping a topic needs no action beyond not removing it.
+	default:
+		s.Topics = appendUnique(s.Topics, phrase)
+	}
+}
+
+// followsCountNoun reports whether the number at tokens[i] counts
+// suggestions: "5 more", "three new subs".
+func followsCountNoun(tokens []Token, i int) bool {
+	for j := i + 1; j < len(tokens) && j <= i+2; j++ {
+		if countNouns[tokens[j].Text] {
+			return true
+		}
+	}
+	return false
+}
+
+// leavesSubreddit reports whether the tokens following "leave" name a
+// subreddit within the next few words.
+func leavesSubreddit(rest []Token) bool {
+	for i, tok := range rest {
+		if i == 4 || tok.Kind == BoundaryToken {
+			return false
+		}
+		if tok.Kind == SubredditToken {
+			return true
+		}
+		w := tok.Text
+		if w == "alone" || w == "it" || w == "them" {
+			return false
+		}
+		if strings.HasPrefix(w, "sub") || strings.HasPrefix(w, "communit") {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// isCommonWord reports whether word is a stop word that carries no topic.
+func isCommonWord(word string) bool {
+	return commonWords[strings.ToLower(word)]
+}
+
+var commonWords = map[string]bool{
+	"the": true, "and": true, "or": true, "but": true, "in": true,
+	"on": true, "at": true, "to": true, "for": true, "of": true,
+	"with": true, "by": true, "from": true, "up": true, "about": true,
+	"into": true, "through": true, "during": true, "before": true,
+	"after": true, "above": true, "below": true, "between": true,
+	"among": true, "is": true, "are": true, "was": true, "were": true,
+	"be": true, "been": true, "being": true, "have": true, "has": true,
+	"had": true, "do": true, "does": true, "did": true, "will": true,
+	"would": true, "could": true, "should": true, "may": true, "might": true,
+	"must": true, "can": true, "please": true, "thanks": true, "thank": true,
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSlots(t *testing.T) {
+	tests := []struct {
+		input string
+		want  IntentSlots
+	}{
+		{
+			input: "don't remove r/books",
+			want:  IntentSlots{Subreddits: []string{"books"}, KeepSubreddits: []string{"books"}, Negated: true},
+		},
+		{
+			input: "don't remove r/books but drop r/news",
+			want: IntentSlots{
+				Subreddits:       []string{"books", "news"},
+				RemoveSubreddits: []string{"news"},
+				KeepSubreddits:   []string{"books"},
+				Negated:          true,
+				Removal:          true,
+			},
+		},
+		{
+			// "leave" and "alone" are not topics, and nothing is removed.
+			input: "I'd like to leave it alone",
+			want:  IntentSlots{},
+		},
+		{
+			input: "I'm into hiking and photography",
+			want:  IntentSlots{Topics: []string{"hiking", "photography"}},
+		},
+		{
+			// Words containing "no" are not negations.
+			input: "I'm into nostalgia",
+			want:  IntentSlots{Topics: []string{"nostalgia"}},
+		},
+		{
+			input: "get rid of news subs",
+			want:  IntentSlots{RemoveTopics: []string{"news"}, Removal: true},
+		},
+		{
+			input: "delete r/funny",
+			want:  IntentSlots{Subreddits: []string{"funny"}, RemoveSubreddits: []string{"funny"}, Removal: true},
+		},
+		{
+			input: "not the anime ones",
+			want:  IntentSlots{ExcludedTopics: []string{"anime"}, Negated: true},
+		},
+		{
+			input: "no crypto subs",
+			want:  IntentSlots{ExcludedTopics: []string{"crypto"}, Negated: true},
+		},
+		{
+			input: "I like cooking, not baking",
+			want:  IntentSlots{Topics: []string{"cooking"}, ExcludedTopics: []string{"baking"}, Negated: true},
+		},
+		{
+			input: "skip r/crypto",
+			want:  IntentSlots{Subreddits: []string{"crypto"}, ExcludedSubreddits: []string{"crypto"}},
+		},
+		{
+			input: "don't add r/x",
+			want:  IntentSlots{Subreddits: []string{"x"}, ExcludedSubreddits: []string{"x"}, Negated: true},
+		},
+		{
+			input: "keep r/pics",
+			want:  IntentSlots{Subreddits: []string{"pics"}, KeepSubreddits: []string{"pics"}},
+		},
+		{
+			input: `add "r/AskHistorians" and r/books`,
+			want: IntentSlots{
+				Subreddits:    []string{"AskHistorians", "books"},
+				AddSubreddits: []string{"AskHistorians", "books"},
+			},
+		},
+		{
+			input: "give me 5 more",
+			want:  IntentSlots{Count: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := normalizeSlots(ParseSlots(tt.input))
+			if want := normalizeSlots(tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseSlots(%q)\n got %+v\nwant %+v", tt.input, got, want)
+			}
+		})
+	}
+}
+
+func TestParseConversationIntentNegatedRemoval(t *testing.T) {
+	tests := []struct {
+		input      string
+		removeMode bool
+	}{
+		{"don't remove r/books", false},
+		{"I'd like to leave it alone", false},
+		{"remove r/news", true},
+		{"don't remove r/books but drop r/news", true},
+	}
+	for _, tt := range tests {
+		if got := ParseConversationIntent(tt.input).RemoveMode; got != tt.removeMode {
+			t.Errorf("ParseConversationIntent(%q).RemoveMode = %v, want %v", tt.input, got, tt.removeMode)
+		}
+	}
+}
+
+// normalizeSlots makes empty and nil slices compare equal.
+func normalizeSlots(s IntentSlots) IntentSlots {
+	for _, list := range []*[]string{
+		&s.Subreddits, &s.AddSubreddits, &s.RemoveSubreddits, &s.KeepSubreddits,
+		&s.ExcludedSubreddits, &s.Topics, &s.RemoveTopics, &s.ExcludedTopics,
+	} {
+		if len(*list) == 0 {
+			*list = nil
+		}
+	}
+	return s
+}
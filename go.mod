@@ -3,6 +3,10 @@ module github.com/HenryArin/ReddmeitAlpha
 go 1.24.4
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/joho/godotenv v1.5.1
 	github.com/sashabaranov/go-openai v1.40.2
+	golang.org/x/term v0.36.0
 )
+
+require golang.org/x/sys v0.37.0 // indirect
@@ -1,13 +1,11 @@
 package main
 
 import (
-	"log"
+	"os"
 
 	"github.com/HenryArin/ReddmeitAlpha/services"
 )
 
 func main() {
-	if err := services.RunInteractiveSession(); err != nil {
-		log.Fatalf("Error: %v", err)
-	}
+	os.Exit(services.RunCLI(os.Args[1:]))
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ApplyResult is the outcome of one subscribe or unsubscribe call.
+type ApplyResult struct {
+	Subreddit string `json:"subreddit"`
+	Action    string `json:"action"` // "sub" or "unsub"
+	OK        bool   `json:"ok"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ApplyRecord is one entry of the apply log, kept so changes can be undone.
+type ApplyRecord struct {
+	AppliedAt time.Time     `json:"applied_at"`
+	Results   []ApplyResult `json:"results"`
+}
+
+// SubscriptionExport is a portable list of a user's subscriptions.
+type SubscriptionExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	User       string    `json:"user,omitempty"`
+	Subreddits []string  `json:"subreddits"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// PlanSchemaVersion is the version of the PlanDocument format written by
+// this build. Version 1 is the bare RecommendationPlan saved by earlier
+// releases, which is still read.
+const PlanSchemaVersion = 2
+
+// PlanDocument is the file format for saved plans: the changes plus where
+// they came from.
+type PlanDocument struct {
+	Schema        int           `json:"schema"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Account       string        `json:"account,omitempty"`
+	Prompts       []string      `json:"prompts,omitempty"`
+	Model         string        `json:"model,omitempty"`
+	PromptVersion string        `json:"prompt_version,omitempty"`
+	Items         []PlanItem    `json:"items"`
+	Conversation  []ChatMessage `json:"conversation,omitempty"`
+
+	// Reply is the assistant's answer when the request only asked for
+	// information and produced no changes.
+	Reply string `json:"reply,omitempty"`
+
+	// Hash is a sha256 of the items, so edits after saving can be spotted.
+	Hash string `json:"hash"`
+}
+
+// PlanItem is one change in a saved plan.
+type PlanItem struct {
+	Subreddit string `json:"subreddit"`
+	Action    string `json:"action"` // "add" or "remove"
+	Category  string `json:"category,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+
+	// RequestConfidence is how sure the assistant was about the whole
+	// request that produced the item, not about the item itself; items the
+	// user added by hand are 1.
+	RequestConfidence float64 `json:"request_confidence,omitempty"`
+	Source            string  `json:"source,omitempty"` // "model", "agent", "user" or "import"
+}
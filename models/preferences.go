@@ -0,0 +1,9 @@
+package models
+
+// Preferences is what the assistant has learned about the user across
+// sessions. Subreddits are stored as "r/name".
+type Preferences struct {
+	BlockedSubs   []string `json:"blocked_subs"`
+	BlockedTopics []string `json:"blocked_topics"`
+	LikedTopics   []string `json:"liked_topics"`
+}
@@ -14,4 +14,37 @@ type RecommendationPlan struct {
 	ViewOnly     bool              `json:"view_only,omitempty"`
 	Reply        string            `json:"reply,omitempty"`
 	Explanations map[string]string `json:"explanations,omitempty"`
+
+	// Categories maps a subreddit to the heading the model grouped it
+	// under, such as "🥐 Baking".
+	Categories map[string]string `json:"categories,omitempty"`
+
+	// Sources records, per subreddit, where the suggestion came from.
+	// RequestConfidence is how confident the intent classifier was about
+	// the request that produced the suggestion. It is a request-level value
+	// copied onto each item, not a score for the individual subreddit;
+	// merged plans keep the value from whichever request an item came from.
+	Sources           map[string]string  `json:"sources,omitempty"`
+	RequestConfidence map[string]float64 `json:"request_confidence,omitempty"`
+
+	// PromptVersion identifies the prompt templates that produced the plan.
+	PromptVersion string `json:"prompt_version,omitempty"`
+
+	// Conversation is the chat history that led to the plan, if saved with it.
+	Conversation []ChatMessage `json:"conversation,omitempty"`
+}
+
+// PlanDiff compares a saved plan with the user's current subscriptions.
+// Changes that already happened since the plan was made are stale.
+type PlanDiff struct {
+	ToAdd             []string `json:"to_add"`             // not subscribed yet
+	ToRemove          []string `json:"to_remove"`          // still subscribed
+	AlreadySubscribed []string `json:"already_subscribed"` // stale additions
+	NotSubscribed     []string `json:"not_subscribed"`     // stale removals
+}
+
+// ChatMessage is one turn of the conversation with the assistant
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
 }
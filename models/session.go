@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SessionState is what an interactive session saves so it can be resumed.
+type SessionState struct {
+	SavedAt        time.Time            `json:"saved_at"`
+	Plan           RecommendationPlan   `json:"plan"`
+	LastSuggestion RecommendationPlan   `json:"last_suggestion"`
+	Undo           []RecommendationPlan `json:"undo,omitempty"`
+	Conversation   []ChatMessage        `json:"conversation,omitempty"`
+	Shown          []string             `json:"shown,omitempty"`
+	Prompts        []string             `json:"prompts,omitempty"`
+	Topics         []string             `json:"topics,omitempty"`
+	SkippedSubs    []string             `json:"skipped_subs,omitempty"`
+	SkippedTopics  []string             `json:"skipped_topics,omitempty"`
+}
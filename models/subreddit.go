@@ -1,8 +1,25 @@
 package models
 
 type SubredditStats struct {
-	Name       string
-	Subscribed bool
-	Upvoted    bool
-	Commented  bool
+	Name       string `json:"name"`
+	Subscribed bool   `json:"subscribed"`
+	Upvoted    bool   `json:"upvoted"`
+	Commented  bool   `json:"commented"`
+}
+
+// SubredditInfo is the public metadata Reddit reports for a community
+type SubredditInfo struct {
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Subscribers int    `json:"subscribers"`
+	Over18      bool   `json:"over_18,omitempty"`
+}
+
+// PostSummary is a condensed view of a post used to judge a community's content
+type PostSummary struct {
+	Title       string `json:"title"`
+	Score       int    `json:"score"`
+	NumComments int    `json:"num_comments"`
+	Permalink   string `json:"permalink"`
 }
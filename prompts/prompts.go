@@ -0,0 +1,168 @@
+// Package prompts holds the text/template prompts sent to the model.
+//
+// The templates under templates/ are embedded into the binary. Any file with
+// the same name placed in the override directory (REDDMEIT_PROMPT_DIR, or
+// "prompts" inside the config directory) replaces the embedded copy, so prompts
+// can be tuned without recompiling.
+package prompts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+)
+
+// Template names understood by Render.
+const (
+	System    = "system.tmpl"
+	Discover  = "discover.tmpl"
+	Remove    = "remove.tmpl"
+	Summarize = "summarize.tmpl"
+	Agent     = "agent.tmpl"
+	Intent    = "intent.tmpl"
+)
+
+//go:embed templates/*.tmpl templates/VERSION
+var embedded embed.FS
+
+// Data is the value every template is executed with.
+type Data struct {
+	UserPrompt string
+	Subscribed []string
+
+	// AlreadySuggested lists subreddits shown earlier in the session so
+	// follow-up requests don't repeat them.
+	AlreadySuggested []string
+
+	// Count is how many new subreddits were asked for ("5 more"); zero
+	// leaves it to the model.
+	Count int
+
+	// Preferences are the user's learned likes and blocks.
+	Preferences models.Preferences
+
+	// Summary and Transcript feed the history summarization prompt.
+	Summary    string
+	Transcript string
+}
+
+// Set is a parsed collection of prompt templates plus the version that
+// identifies them. The version is stored with saved plans so a
+// recommendation can be traced back to the prompts that produced it.
+type Set struct {
+	Version   string
+	Overrides []string
+	tmpl      *template.Template
+}
+
+var (
+	defaultOnce sync.Once
+	defaultSet  *Set
+)
+
+// Default returns the prompt set loaded from the override directory, falling
+// back to the embedded templates if the overrides fail to parse.
+func Default() *Set {
+	defaultOnce.Do(func() {
+		set, err := Load(OverrideDir())
+		if err != nil {
+			fmt.Printf("⚠️  Ignoring prompt overrides: %v\n", err)
+			set, err = Load("")
+			if err != nil {
+				panic(err) // embedded templates are part of the build
+			}
+		}
+		defaultSet = set
+	})
+	return defaultSet
+}
+
+// OverrideDir returns the directory searched for prompt overrides.
+func OverrideDir() string {
+	if dir := os.Getenv("REDDMEIT_PROMPT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(utils.ConfigDir(), "prompts")
+}
+
+// Load parses the embedded templates and then any *.tmpl files in dir, which
+// replace embedded templates of the same name. A VERSION file in dir sets the
+// version explicitly; otherwise overrides get a version derived from their
+// contents.
+func Load(dir string) (*Set, error) {
+	root, err := template.New("prompts").Funcs(funcs).ParseFS(embedded, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	version, err := fs.ReadFile(embedded, "templates/VERSION")
+	if err != nil {
+		return nil, err
+	}
+	set := &Set{Version: strings.TrimSpace(string(version)), tmpl: root}
+	if dir == "" {
+		return set, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	hash := sha256.New()
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(file)
+		if _, err := root.New(name).Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		set.Overrides = append(set.Overrides, name)
+		hash.Write([]byte(name))
+		hash.Write(content)
+	}
+
+	if custom, err := os.ReadFile(filepath.Join(dir, "VERSION")); err == nil {
+		set.Version = strings.TrimSpace(string(custom))
+	} else if len(set.Overrides) > 0 {
+		set.Version += "+custom." + hex.EncodeToString(hash.Sum(nil))[:8]
+	}
+	return set, nil
+}
+
+// Render executes the named template with data.
+func (s *Set) Render(name string, data Data) (string, error) {
+	t := s.tmpl.Lookup(name)
+	if t == nil {
+		return "", fmt.Errorf("unknown prompt template %q", name)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"subs": func(names []string) []string {
+		out := make([]string, len(names))
+		for i, name := range names {
+			out[i] = "r/" + name
+		}
+		return out
+	},
+}
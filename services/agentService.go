@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HenryArin/ReddmeitAlpha/controllers"
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultMaxToolCalls = 8
+
+// agentEnabled reports whether recommendations should use the tool-calling
+// agent (REDDMEIT_AGENT=1) instead of a single completion.
+func agentEnabled() bool {
+	on, _ := strconv.ParseBool(os.Getenv("REDDMEIT_AGENT"))
+	return on
+}
+
+// agentMaxToolCalls is the tool-call budget per request, set with
+// REDDMEIT_AGENT_MAX_TOOL_CALLS.
+func agentMaxToolCalls() int {
+	if n, err := strconv.Atoi(os.Getenv("REDDMEIT_AGENT_MAX_TOOL_CALLS")); err == nil && n >= 0 {
+		return n
+	}
+	return defaultMaxToolCalls
+}
+
+// redditTools backs the agent's tool calls with the Reddit API. Every
+// community the agent looks up successfully is remembered in verified so the
+// final plan can be checked against real subreddits.
+type redditTools struct {
+	accessToken string
+	subscribed  map[string]bool
+	upvoted     map[string]bool
+	commented   map[string]bool
+	verified    map[string]models.SubredditInfo
+}
+
+func newRedditTools(accessToken string, subscribed, upvoted, commented map[string]bool) *redditTools {
+	return &redditTools{
+		accessToken: accessToken,
+		subscribed:  subscribed,
+		upvoted:     upvoted,
+		commented:   commented,
+		verified:    make(map[string]models.SubredditInfo),
+	}
+}
+
+func (t *redditTools) definitions() []openai.Tool {
+	subredditParam := json.RawMessage(`{
+		"type": "object",
+		"properties": {"subreddit": {"type": "string", "description": "Subreddit name without the r/ prefix"}},
+		"required": ["subreddit"]
+	}`)
+	return []openai.Tool{
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "search_subreddits",
+			Description: "Search Reddit for communities matching a topic. Returns names, titles, descriptions and subscriber counts.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"query": {"type": "string"},
+					"limit": {"type": "integer", "description": "Maximum results (1-25)"}
+				},
+				"required": ["query"]
+			}`),
+		}},
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "get_subreddit_about",
+			Description: "Get a subreddit's description, subscriber count and rules. Fails if the subreddit does not exist.",
+			Parameters:  subredditParam,
+		}},
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "list_subscriptions",
+			Description: "List the user's subscribed subreddits and the ones they upvoted or commented in, with an engagement score.",
+			Parameters:  json.RawMessage(`{"type": "object", "properties": {}}`),
+		}},
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "list_top_posts",
+			Description: "List this week's top posts of a subreddit to judge what it is about.",
+			Parameters:  subredditParam,
+		}},
+	}
+}
+
+// call runs one tool and returns its JSON result. Failures are reported to
+// the model as {"error": ...} rather than aborting the request.
+func (t *redditTools) call(name, arguments string) string {
+	var args struct {
+		Query     string `json:"query"`
+		Limit     int    `json:"limit"`
+		Subreddit string `json:"subreddit"`
+	}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return toolError(fmt.Errorf("invalid arguments: %w", err))
+		}
+	}
+
+	var result any
+	var err error
+	switch name {
+	case "search_subreddits":
+		if args.Limit <= 0 || args.Limit > 25 {
+			args.Limit = 10
+		}
+		var found []models.SubredditInfo
+		found, err = SearchSubreddits(args.Query, t.accessToken, args.Limit)
+		for _, info := range found {
+			t.verify(info)
+		}
+		result = found
+	case "get_subreddit_about":
+		var info models.SubredditInfo
+		info, err = FetchSubredditAbout(args.Subreddit, t.accessToken)
+		if err == nil {
+			t.verify(info)
+			rules, _ := FetchSubredditRules(args.Subreddit, t.accessToken)
+			result = struct {
+				models.SubredditInfo
+				Rules []string `json:"rules,omitempty"`
+			}{info, rules}
+		}
+	case "list_subscriptions":
+		result = t.subscriptions()
+	case "list_top_posts":
+		result, err = FetchTopPosts(args.Subreddit, t.accessToken, "week", 10)
+	default:
+		err = fmt.Errorf("unknown tool %q", name)
+	}
+	if err != nil {
+		return toolError(err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return toolError(err)
+	}
+	return string(data)
+}
+
+func (t *redditTools) verify(info models.SubredditInfo) {
+	if info.Name != "" {
+		t.verified[strings.ToLower(info.Name)] = info
+	}
+}
+
+type subscriptionStats struct {
+	Name       string `json:"name"`
+	Subscribed bool   `json:"subscribed"`
+	Upvoted    bool   `json:"upvoted"`
+	Commented  bool   `json:"commented"`
+	Score      int    `json:"engagement_score"`
+}
+
+func (t *redditTools) subscriptions() []subscriptionStats {
+	var out []subscriptionStats
+	for _, stat := range controllers.CombineSubredditStats(t.subscribed, t.upvoted, t.commented) {
+		s := subscriptionStats{Name: stat.Name, Subscribed: stat.Subscribed, Upvoted: stat.Upvoted, Commented: stat.Commented}
+		for _, on := range []bool{stat.Subscribed, stat.Upvoted, stat.Commented} {
+			if on {
+				s.Score++
+			}
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func toolError(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
+
+// runAgent lets the model call Reddit tools until it answers with a final
+// reply or spends maxToolCalls, after which it must answer without tools.
+// Tool activity and the final reply are written to out (which may be nil).
+func runAgent(ctx context.Context, client *openai.Client, model string, messages []openai.ChatCompletionMessage, tools *redditTools, maxToolCalls int, out io.Writer) (string, error) {
+	messages = append([]openai.ChatCompletionMessage(nil), messages...)
+	calls := 0
+	for {
+		req := openai.ChatCompletionRequest{Model: model, Messages: messages}
+		if calls < maxToolCalls {
+			req.Tools = tools.definitions()
+		} else {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "Tool budget exhausted. Give your final answer now using only communities you have verified.",
+			})
+			req.Messages = messages
+		}
+
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("model returned no choices")
+		}
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 || calls >= maxToolCalls {
+			if out != nil {
+				fmt.Fprint(out, msg.Content)
+			}
+			return msg.Content, nil
+		}
+
+		messages = append(messages, msg)
+		for _, call := range msg.ToolCalls {
+			calls++
+			if out != nil {
+				fmt.Fprintf(out, "🔧 %s %s\n", call.Function.Name, call.Function.Arguments)
+			}
+			result := toolError(fmt.Errorf("tool budget exhausted"))
+			if calls <= maxToolCalls {
+				result = tools.call(call.Function.Name, call.Function.Arguments)
+			}
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				ToolCallID: call.ID,
+				Content:    result,
+			})
+		}
+	}
+}
+
+// verifyAdds keeps only additions that exist on Reddit, using the agent's
+// lookups first and the API for anything it didn't check. Names are
+// rewritten to Reddit's canonical casing. Dropped names are noted on out.
+func verifyAdds(plan models.RecommendationPlan, tools *redditTools, out io.Writer) models.RecommendationPlan {
+	var verified []string
+	for _, sub := range plan.ToAdd {
+		name := strings.TrimPrefix(sub, "r/")
+		info, ok := tools.verified[strings.ToLower(name)]
+		if !ok {
+			var err error
+			info, err = FetchSubredditAbout(name, tools.accessToken)
+			if err != nil {
+				fmt.Fprintf(out, "⚠️  Dropped %s: could not verify it exists (%v)\n", sub, err)
+				continue
+			}
+			tools.verify(info)
+		}
+		canonical := "r/" + info.Name
+		if canonical != sub {
+			renameSub(&plan, sub, canonical)
+		}
+		verified = append(verified, canonical)
+	}
+	plan.ToAdd = verified
+	return plan
+}
+
+// renameSub moves everything the plan records about a subreddit from one
+// name to another, so a renamed addition keeps its reason, category,
+// source and confidence.
+func renameSub(plan *models.RecommendationPlan, from, to string) {
+	rekey(plan.Explanations, from, to)
+	rekey(plan.Categories, from, to)
+	rekey(plan.Sources, from, to)
+	rekey(plan.RequestConfidence, from, to)
+}
+
+func rekey[V any](m map[string]V, from, to string) {
+	if value, ok := m[from]; ok {
+		m[to] = value
+		delete(m, from)
+	}
+}
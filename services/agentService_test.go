@@ -0,0 +1,37 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+func TestRenameSub(t *testing.T) {
+	plan := models.RecommendationPlan{
+		ToAdd:             []string{"r/golang"},
+		Explanations:      map[string]string{"r/golang": "Go news"},
+		Categories:        map[string]string{"r/golang": "Programming"},
+		Sources:           map[string]string{"r/golang": "agent"},
+		RequestConfidence: map[string]float64{"r/golang": 0.9},
+	}
+	renameSub(&plan, "r/golang", "r/Golang")
+
+	want := models.RecommendationPlan{
+		ToAdd:             []string{"r/golang"},
+		Explanations:      map[string]string{"r/Golang": "Go news"},
+		Categories:        map[string]string{"r/Golang": "Programming"},
+		Sources:           map[string]string{"r/Golang": "agent"},
+		RequestConfidence: map[string]float64{"r/Golang": 0.9},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("renameSub() = %+v, want %+v", plan, want)
+	}
+
+	// A plan without metadata is left alone.
+	var empty models.RecommendationPlan
+	renameSub(&empty, "r/golang", "r/Golang")
+	if !reflect.DeepEqual(empty, models.RecommendationPlan{}) {
+		t.Errorf("renameSub() on an empty plan = %+v", empty)
+	}
+}
@@ -2,12 +2,17 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/HenryArin/ReddmeitAlpha/controllers"
+	"github.com/HenryArin/ReddmeitAlpha/prompts"
 	openai "github.com/sashabaranov/go-openai"
 )
 
@@ -21,10 +26,16 @@ func GenerateSubredditRecommendations(userPrompt string, subscribed map[string]b
 	client := openai.NewClient(apiKey)
 
 	// Parse user's intent
-	intent := controllers.ParseConversationIntent(userPrompt)
+	intent := ClassifyIntent(context.Background(), userPrompt)
 
 	// Prepare prompt based on user's request
-	prompt := BuildPrompt(userPrompt, intent, subscribed)
+	prompt, err := BuildPrompt(prompts.Default(), intent, prompts.Data{
+		UserPrompt: userPrompt,
+		Subscribed: sortedNames(subscribed),
+	})
+	if err != nil {
+		log.Fatalf("Prompt error: %v", err)
+	}
 
 	// Send request to GPT
 	resp, err := client.CreateChatCompletion(
@@ -46,81 +57,98 @@ func GenerateSubredditRecommendations(userPrompt string, subscribed map[string]b
 	return resp.Choices[0].Message.Content
 }
 
-// BuildPrompt builds a dynamic prompt depending on intent
-func BuildPrompt(userPrompt string, intent controllers.Intent, subscribed map[string]bool) string {
-	var sb strings.Builder
-
+// BuildPrompt builds a dynamic prompt depending on intent, from the
+// templates in set.
+func BuildPrompt(set *prompts.Set, intent controllers.Intent, data prompts.Data) (string, error) {
 	if intent.RemoveMode {
 		// System-instructed safe prompt for removals
-		sb.WriteString(fmt.Sprintf(`The user said: "%s"
-
-They want to remove subreddit topics related to that input.
-
-Your task:
-- ONLY suggest subreddit names that clearly relate to the topic the user wants removed.
-- DO NOT suggest anything unrelated.
-- Format removals as:
-  - r/subredditname - short explanation
-- Also provide explanations in parentheses so they can decide.
-
-Their current subscriptions are:
-%s
-`, userPrompt, formatSubList(subscribed)))
-	} else {
-		// Default discovery prompt
-		sb.WriteString("The user gave the following prompt describing their interests:\n\n")
-		sb.WriteString(userPrompt + "\n\n")
-		sb.WriteString("The user is currently active in these subreddits:\n")
-		for name := range subscribed {
-			sb.WriteString("r/" + name + "\n")
-		}
+		return set.Render(prompts.Remove, data)
+	}
+	// Default discovery prompt
+	return set.Render(prompts.Discover, data)
+}
 
-		sb.WriteString(`
-Please recommend subreddit changes using this format:
-+ r/something     // to subscribe
-- r/oldsubreddit  // to unsubscribe
-= r/keepsubreddit // to keep if needed
+// streamCompletion sends req as a streaming completion, copying each chunk to
+// out as it arrives, and returns the full reply. A cancelled ctx stops the
+// stream and returns ctx.Err().
+func streamCompletion(ctx context.Context, client *openai.Client, req openai.ChatCompletionRequest, out io.Writer) (string, error) {
+	req.Stream = true
+	stream, err := client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
 
-Avoid commentary or explanation. Keep only subreddit suggestions in output.
-`)
+	var reply strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", err
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta.Content
+		reply.WriteString(delta)
+		if out != nil {
+			fmt.Fprint(out, delta)
+		}
 	}
-	return sb.String()
+	return reply.String(), nil
 }
 
-// formatSubList turns map[string]bool into a comma-separated r/sub list
-func formatSubList(subs map[string]bool) string {
-	var list []string
-	for name := range subs {
-		list = append(list, "r/"+name)
+// chatModel returns the model used for recommendations. REDDMEIT_MODEL
+// overrides the default.
+func chatModel() string {
+	if model := os.Getenv("REDDMEIT_MODEL"); model != "" {
+		return model
 	}
-	return strings.Join(list, ", ")
+	return openai.GPT4o
 }
 
-// RefineRecommendationsWithMemory lets GPT iterate with memory on multi-turn conversations
-func RefineRecommendationsWithMemory(messages []openai.ChatCompletionMessage) (string, []openai.ChatCompletionMessage) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("Missing OPENAI_API_KEY")
+// activityThreshold is how many of subscribed, upvoted and commented a
+// subreddit needs to count as active. REDDMEIT_ACTIVITY_THRESHOLD overrides
+// the default of 2.
+func activityThreshold() int {
+	if n, err := strconv.Atoi(os.Getenv("REDDMEIT_ACTIVITY_THRESHOLD")); err == nil && n >= 1 && n <= 3 {
+		return n
 	}
+	return 2
+}
 
-	client := openai.NewClient(apiKey)
+// sortedNames returns the keys of a subreddit set in a stable order so that
+// identical inputs always render identical prompts.
+func sortedNames(subs map[string]bool) []string {
+	var names []string
+	for name := range subs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model:    openai.GPT4o,
-			Messages: messages,
-		},
-	)
+// RefineRecommendationsWithMemory lets GPT iterate with memory on multi-turn
+// conversations. The reply is streamed to out (which may be nil) and appended
+// to the returned messages.
+func RefineRecommendationsWithMemory(ctx context.Context, client *openai.Client, model string, messages []openai.ChatCompletionMessage, out io.Writer) (string, []openai.ChatCompletionMessage, error) {
+	reply, err := streamCompletion(ctx, client, openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: messages,
+	}, out)
 	if err != nil {
-		log.Fatalf("GPT memory error: %v", err)
+		return "", messages, err
 	}
 
-	reply := resp.Choices[0].Message.Content
 	messages = append(messages, openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleAssistant,
 		Content: reply,
 	})
 
-	return reply, messages
+	return reply, messages, nil
 }
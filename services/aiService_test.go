@@ -0,0 +1,42 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HenryArin/ReddmeitAlpha/controllers"
+	"github.com/HenryArin/ReddmeitAlpha/prompts"
+)
+
+func TestBuildPromptUsesGivenSet(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"discover.tmpl": "custom discover: {{.UserPrompt}}",
+		"remove.tmpl":   "custom remove: {{.UserPrompt}}",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set, err := prompts.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		intent controllers.Intent
+		want   string
+	}{
+		{controllers.Intent{}, "custom discover: woodworking"},
+		{controllers.Intent{RemoveMode: true}, "custom remove: woodworking"},
+	}
+	for _, tt := range tests {
+		got, err := BuildPrompt(set, tt.intent, prompts.Data{UserPrompt: "woodworking"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("BuildPrompt(RemoveMode=%v) = %q, want %q", tt.intent.RemoveMode, got, tt.want)
+		}
+	}
+}
@@ -2,30 +2,133 @@ package services
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
 )
 
 // ApplyPlan subscribes and unsubscribes based on the AI's recommendation plan.
-func ApplyPlan(plan models.RecommendationPlan, accessToken string) {
+// It refuses to unsubscribe from anything on the protected list. The results
+// are returned and recorded in the apply log so they can be undone. A line
+// per change is written to out.
+func ApplyPlan(plan models.RecommendationPlan, accessToken string, protected *utils.ProtectedList, out io.Writer) []models.ApplyResult {
+	return ApplyPlanProgress(plan, accessToken, protected, out, nil)
+}
+
+// ApplyPlanProgress works like ApplyPlan and also calls progress with each
+// result as soon as that change is done, so callers can show them live.
+func ApplyPlanProgress(plan models.RecommendationPlan, accessToken string, protected *utils.ProtectedList, out io.Writer, progress func(models.ApplyResult)) []models.ApplyResult {
+	results := applyChanges(plan, accessToken, protected, out, progress)
+	if len(results) > 0 {
+		record := models.ApplyRecord{AppliedAt: time.Now(), Results: results}
+		if err := utils.AppendApplyLog(record); err != nil {
+			fmt.Fprintf(out, "⚠️  Failed to record applied changes: %v\n", err)
+		}
+	}
+	return results
+}
+
+// UndoLastApply reverses the most recent apply in the log: subreddits it
+// subscribed to are unsubscribed and the ones it left are joined again.
+// Only changes that succeeded are reversed. The entry is removed from the
+// log, so calling it again goes further back. Progress is written to out.
+func UndoLastApply(accessToken string, protected *utils.ProtectedList, out io.Writer) ([]models.ApplyResult, error) {
+	records, err := utils.LoadApplyLog()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("nothing to undo")
+	}
+	last := records[len(records)-1]
+	results := applyChanges(InversePlan(last), accessToken, protected, out, nil)
+	if err := utils.RemoveApplyRecord(last.AppliedAt); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// InversePlan returns the plan that reverses the successful changes of an
+// apply.
+func InversePlan(record models.ApplyRecord) models.RecommendationPlan {
+	var plan models.RecommendationPlan
+	for _, r := range record.Results {
+		if !r.OK {
+			continue
+		}
+		switch r.Action {
+		case "sub":
+			plan.ToRemove = append(plan.ToRemove, r.Subreddit)
+		case "unsub":
+			plan.ToAdd = append(plan.ToAdd, r.Subreddit)
+		}
+	}
+	return plan
+}
+
+// ApplyFailures counts the changes that did not go through. Changes that
+// were skipped on purpose, such as protected subreddits, are not failures.
+func ApplyFailures(results []models.ApplyResult) int {
+	failed := 0
+	for _, r := range results {
+		if !r.OK && !r.Skipped {
+			failed++
+		}
+	}
+	return failed
+}
+
+// ApplySkipped counts the changes that were skipped on purpose.
+func ApplySkipped(results []models.ApplyResult) int {
+	skipped := 0
+	for _, r := range results {
+		if r.Skipped {
+			skipped++
+		}
+	}
+	return skipped
+}
+
+func applyChanges(plan models.RecommendationPlan, accessToken string, protected *utils.ProtectedList, out io.Writer, progress func(models.ApplyResult)) []models.ApplyResult {
 	client := &http.Client{}
+	var results []models.ApplyResult
+	report := func(r models.ApplyResult) {
+		results = append(results, r)
+		if progress != nil {
+			progress(r)
+		}
+	}
 
 	for _, sub := range plan.ToAdd {
-		performSubredditAction(client, accessToken, "sub", sub)
+		report(performSubredditAction(client, accessToken, "sub", sub, out))
 	}
 
 	for _, sub := range plan.ToRemove {
-		performSubredditAction(client, accessToken, "unsub", sub)
+		if protected.Contains(sub) {
+			fmt.Fprintf(out, "🛡️  Refusing to unsubscribe from %s: it is on your protected list.\n", sub)
+			report(models.ApplyResult{
+				Subreddit: sub,
+				Action:    "unsub",
+				Skipped:   true,
+				Error:     "protected",
+			})
+			continue
+		}
+		report(performSubredditAction(client, accessToken, "unsub", sub, out))
 	}
+	return results
 }
 
 // performSubredditAction calls the Reddit API to subscribe or unsubscribe
-func performSubredditAction(client *http.Client, accessToken, action, subreddit string) {
+func performSubredditAction(client *http.Client, accessToken, action, subreddit string, out io.Writer) models.ApplyResult {
 	// Clean the subreddit name - remove "r/" prefix if present
 	cleanSubreddit := strings.TrimPrefix(subreddit, "r/")
+	result := models.ApplyResult{Subreddit: "r/" + cleanSubreddit, Action: action}
 
 	form := url.Values{}
 	form.Set("action", action)
@@ -38,14 +141,18 @@ func performSubredditAction(client *http.Client, accessToken, action, subreddit
 
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("❌ Failed %s on %s: %v\n", action, cleanSubreddit, err)
-		return
+		fmt.Fprintf(out, "❌ Failed %s on %s: %v\n", action, cleanSubreddit, err)
+		result.Error = err.Error()
+		return result
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		fmt.Printf("⚠️  Reddit API returned %d for %s %s\n", resp.StatusCode, action, cleanSubreddit)
+		fmt.Fprintf(out, "⚠️  Reddit API returned %d for %s %s\n", resp.StatusCode, action, cleanSubreddit)
+		result.Error = fmt.Sprintf("reddit returned %d", resp.StatusCode)
 	} else {
-		fmt.Printf("✅ %s: r/%s\n", strings.ToUpper(action), cleanSubreddit)
+		fmt.Fprintf(out, "✅ %s: r/%s\n", strings.ToUpper(action), cleanSubreddit)
+		result.OK = true
 	}
+	return result
 }
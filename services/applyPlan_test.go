@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+func TestApplyCounts(t *testing.T) {
+	tests := []struct {
+		name            string
+		results         []models.ApplyResult
+		failed, skipped int
+	}{
+		{name: "none"},
+		{
+			name:    "all applied",
+			results: []models.ApplyResult{{Subreddit: "r/a", Action: "sub", OK: true}},
+		},
+		{
+			name: "protected skips are not failures",
+			results: []models.ApplyResult{
+				{Subreddit: "r/a", Action: "sub", OK: true},
+				{Subreddit: "r/b", Action: "unsub", Skipped: true, Error: "protected"},
+			},
+			skipped: 1,
+		},
+		{
+			name: "failures and skips",
+			results: []models.ApplyResult{
+				{Subreddit: "r/a", Action: "sub", Error: "reddit returned 403"},
+				{Subreddit: "r/b", Action: "unsub", Skipped: true, Error: "protected"},
+				{Subreddit: "r/c", Action: "unsub", OK: true},
+			},
+			failed:  1,
+			skipped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ApplyFailures(tt.results); got != tt.failed {
+				t.Errorf("ApplyFailures() = %d, want %d", got, tt.failed)
+			}
+			if got := ApplySkipped(tt.results); got != tt.skipped {
+				t.Errorf("ApplySkipped() = %d, want %d", got, tt.skipped)
+			}
+		})
+	}
+}
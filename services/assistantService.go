@@ -3,48 +3,61 @@ package services
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
 
 	"github.com/HenryArin/ReddmeitAlpha/controllers"
 	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/prompts"
 	"github.com/HenryArin/ReddmeitAlpha/utils"
 	openai "github.com/sashabaranov/go-openai"
 )
 
-var lastUserInterest string
-var lastPlan models.RecommendationPlan
-
 type AssistantResult struct {
 	ViewOnly bool
 	Reply    string
 	Plan     models.RecommendationPlan
-}
 
-func HandleRequest(userPrompt string, intent controllers.Intent, subscribed, upvoted, commented map[string]bool) (AssistantResult, error) {
-	if !intent.ShowSubList && strings.TrimSpace(userPrompt) != "" {
-		lastUserInterest = userPrompt
-	}
+	// Cached is set when the reply came from the completion cache rather
+	// than from the model.
+	Cached bool
+}
 
+// HandleRequest turns one user prompt into a recommendation plan. Earlier
+// turns in the session's history are sent along so follow-ups are understood
+// in context, and the new turn is appended to it (History may be nil for
+// one-off requests). The model's reply is streamed to stream as it arrives (pass nil
+// to stay quiet) and is parsed into the plan once complete. Cancelling ctx
+// aborts the request.
+func (s *Session) HandleRequest(ctx context.Context, userPrompt string, intent controllers.Intent, subscribed, upvoted, commented map[string]bool, stream io.Writer) (AssistantResult, error) {
 	if intent.ShowSubList {
 		reply := buildSubsListing(subscribed, upvoted, commented)
 		return AssistantResult{ViewOnly: true, Reply: reply}, nil
 	}
 
-	if isExclusionOnlyRequest(userPrompt) && hasValidLastPlan() {
-		return handleExclusionRequest(userPrompt, lastPlan, subscribed)
+	if intent.Slots.FeedbackOnly() && s.hasValidLastPlan() {
+		result, err := s.handleExclusionRequest(intent)
+		if err == nil && s.History != nil {
+			s.History.Add(openai.ChatMessageRoleUser, userPrompt)
+			s.History.Add(openai.ChatMessageRoleAssistant, result.Reply)
+		}
+		return result, err
+	}
+
+	if intent.Type == controllers.None {
+		return AssistantResult{ViewOnly: true, Reply: "🤖 Got it. Tell me what you're into, or what you'd like to drop."}, nil
 	}
 
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return AssistantResult{}, fmt.Errorf("OPENAI_API_KEY unset")
+	client, err := s.client()
+	if err != nil {
+		return AssistantResult{}, err
 	}
-	client := openai.NewClient(apiKey)
 
 	active := controllers.FilterActiveSubreddits(
 		controllers.CombineSubredditStats(subscribed, upvoted, commented),
-		2,
+		activityThreshold(),
 	)
 
 	var activeNames []string
@@ -52,56 +65,103 @@ func HandleRequest(userPrompt string, intent controllers.Intent, subscribed, upv
 		activeNames = append(activeNames, strings.TrimPrefix(s, "r/"))
 	}
 
+	promptSet := s.promptSet()
+	systemPrompt, err := promptSet.Render(prompts.System, prompts.Data{})
+	if err != nil {
+		return AssistantResult{}, err
+	}
+	useAgent := s.Agent
+	if useAgent {
+		agentPrompt, err := promptSet.Render(prompts.Agent, prompts.Data{})
+		if err != nil {
+			return AssistantResult{}, err
+		}
+		systemPrompt += agentPrompt
+	}
 	system := openai.ChatCompletionMessage{
-		Role: openai.ChatMessageRoleSystem,
-		Content: `You are a Reddit assistant helping users manage their subreddit subscriptions.
-
-Your task:
-1. Suggest subreddit additions and removals in clearly grouped categories.
-2. Use emoji category headers to group related subreddits. Examples:
-   🥐 Baking:
-   💪 Fitness:
-   🎮 Gaming:
-   🍷 Alcohol:
-   🚗 Cars:
-   🧠 Learning:
-   🧘 Wellness:
-   📚 Books:
-
-Formatting Rules:
-+ r/Subreddit – short reason (for adds)
-- r/Subreddit – short reason (for removes)
-
-3. Always group subreddits under the correct category heading.
-4. Only REMOVE subreddits that clearly relate to the user's removal intent.
-5. Keep explanations concise and helpful.
-6. Output should be readable in markdown/plaintext format — no extra commentary.
-7. If no relevant results, respond with:
-   🤖 No strong subreddit matches. Try rephrasing or being more specific?`,
-	}
-
-	promptInput := userPrompt
-	if intent.RegenerateAdds && lastUserInterest != "" {
-		promptInput = lastUserInterest
+		Role:    openai.ChatMessageRoleSystem,
+		Content: systemPrompt,
+	}
+
+	// The model is told everything it already showed so it never repeats
+	// itself; "N more" also asks for an exact count.
+	count := 0
+	if intent.FollowUpMore {
+		count = intent.Slots.Count
+	}
+	userContent, err := BuildPrompt(promptSet, intent, prompts.Data{
+		UserPrompt:       userPrompt,
+		Subscribed:       sortedNames(subscribed),
+		AlreadySuggested: s.Shown,
+		Count:            count,
+		Preferences:      s.activePrefs(),
+	})
+	if err != nil {
+		return AssistantResult{}, err
 	}
-
 	user := openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleUser,
-		Content: BuildPrompt(promptInput, intent, subscribed),
+		Content: userContent,
 	}
 
-	req := openai.ChatCompletionRequest{
-		Model:    openai.GPT4o,
-		Messages: []openai.ChatCompletionMessage{system, user},
+	model := s.Model
+	if model == "" {
+		model = chatModel()
 	}
-	resp, err := client.CreateChatCompletion(context.Background(), req)
-	if err != nil {
-		return AssistantResult{}, err
+	cacheModel := model
+	if useAgent {
+		cacheModel += "+agent"
+	}
+	messages := append([]openai.ChatCompletionMessage{system}, s.History.Context()...)
+	messages = append(messages, user)
+	cache := s.Cache
+	if cache == nil {
+		cache = &CompletionCache{}
 	}
-	raw := resp.Choices[0].Message.Content
+	cacheKey := CacheKey(cacheModel, promptSet.Version, messages)
+
+	// "More" always asks the model again; anything else may reuse a reply.
+	raw, cached := "", false
+	var tools *redditTools
+	if !intent.FollowUpMore {
+		raw, cached = cache.Get(cacheKey)
+	}
+	if cached {
+		if stream != nil {
+			fmt.Fprint(stream, raw)
+		}
+	} else {
+		if useAgent {
+			tools = newRedditTools(s.RedditToken, subscribed, upvoted, commented)
+			raw, err = runAgent(ctx, client, model, messages, tools, agentMaxToolCalls(), stream)
+		} else {
+			raw, _, err = RefineRecommendationsWithMemory(ctx, client, model, messages, stream)
+		}
+		if err != nil {
+			return AssistantResult{}, err
+		}
+		if err := cache.Put(cacheKey, cacheModel, promptSet.Version, raw); err != nil {
+			s.logf("⚠️  Failed to cache reply: %v\n", err)
+		}
+	}
+	if s.History != nil {
+		// Store what the user typed rather than the rendered prompt, which
+		// repeats the subscription list every turn.
+		s.History.Add(openai.ChatMessageRoleUser, userPrompt)
+		s.History.Add(openai.ChatMessageRoleAssistant, raw)
+		if err := s.History.Compact(ctx, client, model, promptSet); err != nil {
+			s.logf("⚠️  Failed to summarize conversation: %v\n", err)
+		}
+	}
+
 	plan := utils.ParseSubredditPlan(raw)
+	if useAgent {
+		if tools == nil {
+			tools = newRedditTools(s.RedditToken, subscribed, upvoted, commented)
+		}
+		plan = verifyAdds(plan, tools, s.logWriter())
+	}
 
-	lastPlan = plan
 	plan = deduplicatePlan(plan)
 
 	if !intent.RemoveMode {
@@ -116,87 +176,53 @@ Formatting Rules:
 		plan.ToRemove = filtered
 	}
 
-	plan = handleKeepRequests(userPrompt, plan)
+	plan = handleKeepRequests(intent, plan, s.logWriter())
+	plan = honorKeepSuggestions(controllers.ParseRecommendationOutput(raw), plan)
 	plan.ToAdd = filterAlreadySubscribed(plan.ToAdd, subscribed)
-	plan = handleExclusions(userPrompt, plan)
+	plan = handleExclusions(intent, plan, s.logWriter())
+	plan = filterBlocked(s.activePrefs(), plan, s.logWriter())
 	plan = preventOverlap(plan)
-	lastPlan = plan
+	plan.ToAdd = s.filterShown(plan.ToAdd)
+	if count > 0 && len(plan.ToAdd) > count {
+		plan.ToAdd = plan.ToAdd[:count]
+	}
+	plan.PromptVersion = promptSet.Version
+	source := "model"
+	if useAgent {
+		source = "agent"
+	}
+	markSource(&plan, source, intent.Confidence)
+	s.UserPrompts = append(s.UserPrompts, userPrompt)
+	s.lastSuggestion = plan
+	s.rememberShown(plan.ToAdd)
 
 	if len(plan.ToAdd) == 0 && len(plan.ToRemove) == 0 {
 		return AssistantResult{
 			ViewOnly: false,
 			Reply:    "🤖 No strong subreddit matches. Try rephrasing or being more specific?",
 			Plan:     plan,
+			Cached:   cached,
 		}, nil
 	}
 
-	lastPlan = plan
-	return AssistantResult{ViewOnly: false, Reply: raw, Plan: plan}, nil
+	return AssistantResult{ViewOnly: false, Reply: raw, Plan: plan, Cached: cached}, nil
 }
 
-func isExclusionOnlyRequest(userPrompt string) bool {
-	lp := strings.ToLower(strings.TrimSpace(userPrompt))
-	exclusionKeywords := []string{"don't add", "dont add", "skip", "no "}
-	hasExclusionKeyword := false
-	for _, keyword := range exclusionKeywords {
-		if strings.Contains(lp, keyword) {
-			hasExclusionKeyword = true
-			break
-		}
-	}
-	if !hasExclusionKeyword {
-		return false
-	}
-
-	cleaned := lp
-	cleaned = strings.ReplaceAll(cleaned, "don't add", "")
-	cleaned = strings.ReplaceAll(cleaned, "dont add", "")
-	cleaned = strings.ReplaceAll(cleaned, "skip", "")
-	cleaned = strings.ReplaceAll(cleaned, "no", "")
-	cleaned = strings.ReplaceAll(cleaned, "r/", "")
-	cleaned = strings.Trim(cleaned, " .,!?")
-
-	words := strings.Fields(cleaned)
-	meaningfulWords := 0
-	for _, word := range words {
-		if len(word) > 2 && !isCommonWord(word) {
-			meaningfulWords++
-		}
-	}
-	return meaningfulWords <= 1
-}
-
-func isCommonWord(word string) bool {
-	commonWords := map[string]bool{
-		"the": true, "and": true, "or": true, "but": true, "in": true,
-		"on": true, "at": true, "to": true, "for": true, "of": true,
-		"with": true, "by": true, "from": true, "up": true, "about": true,
-		"into": true, "through": true, "during": true, "before": true,
-		"after": true, "above": true, "below": true, "between": true,
-		"among": true, "is": true, "are": true, "was": true, "were": true,
-		"be": true, "been": true, "being": true, "have": true, "has": true,
-		"had": true, "do": true, "does": true, "did": true, "will": true,
-		"would": true, "could": true, "should": true, "may": true, "might": true,
-		"must": true, "can": true, "please": true, "thanks": true, "thank": true,
-	}
-	return commonWords[strings.ToLower(word)]
-}
-
-func hasValidLastPlan() bool {
-	result := len(lastPlan.ToAdd) > 0 || len(lastPlan.ToRemove) > 0
-	fmt.Printf("🔍 Has valid last plan: %t (ToAdd: %d, ToRemove: %d)\n", result, len(lastPlan.ToAdd), len(lastPlan.ToRemove))
-	return result
+func (s *Session) hasValidLastPlan() bool {
+	last := s.lastSuggestion
+	return len(last.ToAdd) > 0 || len(last.ToRemove) > 0
 }
 
-func handleExclusionRequest(userPrompt string, plan models.RecommendationPlan, subscribed map[string]bool) (AssistantResult, error) {
+func (s *Session) handleExclusionRequest(intent controllers.Intent) (AssistantResult, error) {
+	plan := s.lastSuggestion
 	newPlan := models.RecommendationPlan{
 		ToAdd:    make([]string, len(plan.ToAdd)),
 		ToRemove: []string{},
 	}
 	copy(newPlan.ToAdd, plan.ToAdd)
-	newPlan = handleExclusions(userPrompt, newPlan)
+	newPlan = handleExclusions(intent, newPlan, s.logWriter())
 	response := generateExclusionResponse(plan.ToAdd, newPlan.ToAdd)
-	lastPlan = newPlan
+	s.lastSuggestion = newPlan
 	return AssistantResult{
 		ViewOnly: false,
 		Reply:    response,
@@ -234,30 +260,43 @@ func generateExclusionResponse(originalAdds, filteredAdds []string) string {
 	return response
 }
 
-func handleKeepRequests(userPrompt string, plan models.RecommendationPlan) models.RecommendationPlan {
-	lp := strings.ToLower(userPrompt)
-	if strings.Contains(lp, "keep") {
-		words := strings.Fields(lp)
-		for _, word := range words {
-			word = strings.Trim(strings.ToLower(word), ".,!?")
-			if strings.HasPrefix(word, "r/") {
-				sub := word
-				newRemove := []string{}
-				removed := false
-				for _, r := range plan.ToRemove {
-					if strings.ToLower(r) != sub {
-						newRemove = append(newRemove, r)
-					} else {
-						fmt.Printf("🛑 Removed %s from unsubscribe list.\n", sub)
-						removed = true
-					}
-				}
-				if removed {
-					plan.ToRemove = newRemove
-				}
-			}
+// markSource records where every item in plan came from. confidence is the
+// intent confidence of the request as a whole; it is stored against each
+// item only so merged plans remember which request an item came from.
+func markSource(plan *models.RecommendationPlan, source string, confidence float64) {
+	if plan.Sources == nil {
+		plan.Sources = map[string]string{}
+	}
+	if plan.RequestConfidence == nil {
+		plan.RequestConfidence = map[string]float64{}
+	}
+	for _, list := range [][]string{plan.ToAdd, plan.ToRemove} {
+		for _, sub := range list {
+			plan.Sources[sub] = source
+			plan.RequestConfidence[sub] = confidence
+		}
+	}
+}
+
+// handleKeepRequests drops subreddits the user asked to keep ("keep r/x",
+// "don't remove r/x") from the removal list, noting each on out.
+func handleKeepRequests(intent controllers.Intent, plan models.RecommendationPlan, out io.Writer) models.RecommendationPlan {
+	if len(intent.Slots.KeepSubreddits) == 0 {
+		return plan
+	}
+	keep := make(map[string]bool)
+	for _, name := range intent.Slots.KeepSubreddits {
+		keep[strings.ToLower(name)] = true
+	}
+	newRemove := []string{}
+	for _, r := range plan.ToRemove {
+		if keep[strings.ToLower(strings.TrimPrefix(r, "r/"))] {
+			fmt.Fprintf(out, "🛑 Removed %s from unsubscribe list.\n", r)
+			continue
 		}
+		newRemove = append(newRemove, r)
 	}
+	plan.ToRemove = newRemove
 	return plan
 }
 
@@ -280,10 +319,9 @@ func deduplicatePlan(plan models.RecommendationPlan) models.RecommendationPlan {
 			uniqueRemove = append(uniqueRemove, sub)
 		}
 	}
-	return models.RecommendationPlan{
-		ToAdd:    uniqueAdd,
-		ToRemove: uniqueRemove,
-	}
+	plan.ToAdd = uniqueAdd
+	plan.ToRemove = uniqueRemove
+	return plan
 }
 
 func filterAlreadySubscribed(toAdd []string, subscribed map[string]bool) []string {
@@ -297,43 +335,71 @@ func filterAlreadySubscribed(toAdd []string, subscribed map[string]bool) []strin
 	return filtered
 }
 
-func handleExclusions(userPrompt string, plan models.RecommendationPlan) models.RecommendationPlan {
-	excludeSubs := make(map[string]bool)
-	lp := strings.ToLower(userPrompt)
-	if strings.Contains(lp, "don't add") || strings.Contains(lp, "dont add") || strings.Contains(lp, "skip") || strings.Contains(lp, "no ") {
-		clean := strings.ReplaceAll(lp, "don't add", "")
-		clean = strings.ReplaceAll(clean, "dont add", "")
-		clean = strings.ReplaceAll(clean, "skip", "")
-		clean = strings.ReplaceAll(clean, "no", "")
-		parts := strings.FieldsFunc(clean, func(c rune) bool {
-			return c == ',' || c == ' ' || c == '.' || c == '!' || c == '?'
-		})
-		for _, part := range parts {
-			part = strings.TrimSpace(part)
-			if part == "" {
-				continue
-			}
-			if strings.HasPrefix(part, "r/") {
-				subName := strings.TrimPrefix(part, "r/")
-				excludeSubs[strings.ToLower(subName)] = true
-			} else {
-				excludeSubs[strings.ToLower(part)] = true
-			}
+// honorKeepSuggestions drops subreddits the model itself marked "= keep"
+// from the removal list.
+func honorKeepSuggestions(rec models.Recommendation, plan models.RecommendationPlan) models.RecommendationPlan {
+	if len(rec.Keep) == 0 {
+		return plan
+	}
+	var toRemove []string
+	for _, sub := range plan.ToRemove {
+		if !containsSub(rec.Keep, sub) {
+			toRemove = append(toRemove, sub)
 		}
 	}
+	plan.ToRemove = toRemove
+	return plan
+}
+
+// handleExclusions drops additions the user rejected, either by name
+// ("skip r/x") or by topic ("not the anime ones" drops r/anime and
+// r/AnimeSketch), noting each on out.
+func handleExclusions(intent controllers.Intent, plan models.RecommendationPlan, out io.Writer) models.RecommendationPlan {
+	excludeSubs := make(map[string]bool)
+	for _, name := range intent.Slots.ExcludedSubreddits {
+		excludeSubs[strings.ToLower(name)] = true
+	}
+
 	filteredAdd := []string{}
 	for _, sub := range plan.ToAdd {
 		name := strings.ToLower(strings.TrimPrefix(sub, "r/"))
-		if !excludeSubs[name] {
+		excluded := excludeSubs[name]
+		for _, topic := range intent.Slots.ExcludedTopics {
+			if utils.MatchesTopic(sub, topic) {
+				excluded = true
+			}
+		}
+		if !excluded {
 			filteredAdd = append(filteredAdd, sub)
 		} else {
-			fmt.Printf("❌ Skipped %s based on your feedback.\n", sub)
+			fmt.Fprintf(out, "❌ Skipped %s based on your feedback.\n", sub)
 		}
 	}
 	plan.ToAdd = filteredAdd
 	return plan
 }
 
+// filterBlocked drops additions the user's preferences rule out, noting
+// each on out.
+func filterBlocked(prefs models.Preferences, plan models.RecommendationPlan, out io.Writer) models.RecommendationPlan {
+	var toAdd []string
+	for _, sub := range plan.ToAdd {
+		if utils.IsBlocked(prefs, sub) {
+			fmt.Fprintf(out, "🚫 Skipped %s: blocked in your preferences.\n", sub)
+			continue
+		}
+		toAdd = append(toAdd, sub)
+	}
+	plan.ToAdd = toAdd
+	return plan
+}
+
+// ApplyFeedback applies keep and exclude requests from intent to a plan that
+// is already being built, such as the session's merged plan.
+func ApplyFeedback(intent controllers.Intent, plan models.RecommendationPlan) models.RecommendationPlan {
+	return handleExclusions(intent, handleKeepRequests(intent, plan, os.Stdout), os.Stdout)
+}
+
 func preventOverlap(plan models.RecommendationPlan) models.RecommendationPlan {
 	removeMap := make(map[string]bool)
 	for _, r := range plan.ToRemove {
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultCacheTTL = 24 * time.Hour
+
+// CompletionCache stores model replies on disk so that repeating a prompt
+// doesn't hit the API again. A zero-value cache (empty Dir) is disabled.
+type CompletionCache struct {
+	Dir string
+	TTL time.Duration
+}
+
+type cacheEntry struct {
+	CreatedAt     time.Time `json:"created_at"`
+	Model         string    `json:"model"`
+	PromptVersion string    `json:"prompt_version"`
+	Reply         string    `json:"reply"`
+}
+
+// NewCompletionCache builds the cache from the environment:
+// REDDMEIT_CACHE_DIR picks the location, REDDMEIT_CACHE_TTL (a Go duration
+// such as "6h") the lifetime of entries, and REDDMEIT_NO_CACHE=1 bypasses it.
+func NewCompletionCache() *CompletionCache {
+	if off, _ := strconv.ParseBool(os.Getenv("REDDMEIT_NO_CACHE")); off {
+		return &CompletionCache{}
+	}
+	ttl := defaultCacheTTL
+	if raw := os.Getenv("REDDMEIT_CACHE_TTL"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Invalid REDDMEIT_CACHE_TTL %q, using %s\n", raw, defaultCacheTTL)
+		} else {
+			ttl = parsed
+		}
+	}
+	return &CompletionCache{
+		Dir: filepath.Join(utils.CacheDir(), "completions"),
+		TTL: ttl,
+	}
+}
+
+// CacheKey hashes the model, prompt template version and the normalized
+// conversation into a cache key. Normalization ignores case and whitespace
+// differences so "Books " and "books" share an entry.
+func CacheKey(model, promptVersion string, messages []openai.ChatCompletionMessage) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", model, promptVersion)
+	for _, m := range messages {
+		fmt.Fprintf(h, "%s\x00%s\x00", m.Role, normalizeCacheText(m.Content))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func normalizeCacheText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Get returns the cached reply for key if present and not expired.
+func (c *CompletionCache) Get(key string) (string, bool) {
+	if c == nil || c.Dir == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return "", false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", false
+	}
+	if c.TTL > 0 && time.Since(entry.CreatedAt) > c.TTL {
+		os.Remove(c.path(key))
+		return "", false
+	}
+	return entry.Reply, true
+}
+
+// Put stores reply under key.
+func (c *CompletionCache) Put(key, model, promptVersion, reply string) error {
+	if c == nil || c.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cacheEntry{
+		CreatedAt:     time.Now(),
+		Model:         model,
+		PromptVersion: promptVersion,
+		Reply:         reply,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path(key), data, 0o644)
+}
+
+func (c *CompletionCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
@@ -0,0 +1,641 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/controllers"
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+)
+
+// Exit codes returned by RunCLI.
+const (
+	ExitOK    = 0
+	ExitError = 1 // the command failed, or some changes could not be applied
+	ExitUsage = 2 // bad command line
+	ExitAPI   = 3 // Reddit couldn't be reached or rejected the request, e.g. an expired token
+)
+
+// cliContext is what every subcommand gets: where to write and the common
+// flags.
+type cliContext struct {
+	out      io.Writer // the command's result
+	progress io.Writer // status messages, kept apart so --json output stays clean
+	json     bool
+	output   string // --out
+	dryRun   bool   // --dry-run
+	format   string // --format
+	addr     string // --addr
+	profile  string // --profile
+}
+
+type cliCommand struct {
+	name  string
+	args  string // usage shown by help
+	help  string
+	run   func(c *cliContext, args []string) error
+	token bool // needs REDDIT_ACCESS_TOKEN
+}
+
+var cliCommands []cliCommand
+
+func init() {
+	cliCommands = []cliCommand{
+		{"subs", "", "List your subscriptions", cliSubs, true},
+		{"activity", "", "List subreddits you subscribe to, upvote or comment in", cliActivity, true},
+		{"recommend", "\"<prompt>\"", "Ask for recommendations without starting a session", cliRecommend, true},
+		{"plan", "show|diff <file>", "Print a saved plan, or compare it with your subscriptions", cliPlan, false},
+		{"apply", "<file>", "Apply the parts of a saved plan that haven't happened yet", cliApply, true},
+		{"export", "", "Export your subscriptions as JSON", cliExport, true},
+		{"import", "<file>", "Subscribe to every subreddit in an export", cliImport, true},
+		{"undo", "", "Reverse the last applied changes", cliUndo, true},
+		{"serve", "[--addr host:port]", "Serve the JSON API for local tools", cliServe, true},
+		{"config", "validate", "Check the config file and the selected profile", cliConfig, false},
+		{"help", "", "Show this help", nil, false},
+	}
+}
+
+// usageError marks errors caused by a bad command line.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+// RunCLI runs the command line and returns the process exit code. Without a
+// subcommand it starts the interactive session.
+func RunCLI(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fs := flag.NewFlagSet("reddmeit", flag.ContinueOnError)
+		fs.Usage = func() { printCLIUsage(os.Stderr) }
+		resume := fs.Bool("resume", false, "continue the last autosaved session")
+		tui := fs.Bool("tui", false, "use the full-screen terminal UI")
+		profile := fs.String("profile", "", "use this profile from the config file")
+		noCache := fs.Bool("no-cache", false, "always call the model instead of reusing cached replies")
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return ExitOK
+			}
+			return ExitUsage
+		}
+		if *profile != "" {
+			os.Setenv("REDDMEIT_PROFILE", *profile)
+		}
+		if *noCache {
+			os.Setenv("REDDMEIT_NO_CACHE", "1")
+		}
+		run := RunInteractiveSession
+		if *tui {
+			run = RunTUI
+		}
+		if err := run(*resume); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitError
+		}
+		return ExitOK
+	}
+
+	name := args[0]
+	if name == "help" || name == "--help" {
+		printCLIUsage(os.Stdout)
+		return ExitOK
+	}
+	var cmd *cliCommand
+	for i := range cliCommands {
+		if cliCommands[i].name == name && cliCommands[i].run != nil {
+			cmd = &cliCommands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", name)
+		printCLIUsage(os.Stderr)
+		return ExitUsage
+	}
+
+	c := &cliContext{out: os.Stdout, progress: os.Stderr}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&c.json, "json", false, "print JSON")
+	fs.StringVar(&c.output, "out", "", "write the result to a file")
+	fs.BoolVar(&c.dryRun, "dry-run", false, "show what would change without changing it")
+	fs.StringVar(&c.format, "format", "", "output format for plans")
+	fs.StringVar(&c.addr, "addr", "", "address for serve to listen on")
+	fs.StringVar(&c.profile, "profile", "", "use this profile from the config file")
+	noCache := fs.Bool("no-cache", false, "always call the model instead of reusing cached replies")
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitUsage
+	}
+
+	if c.profile != "" {
+		os.Setenv("REDDMEIT_PROFILE", c.profile)
+	}
+	if *noCache {
+		os.Setenv("REDDMEIT_NO_CACHE", "1")
+	}
+	// config validate reports a broken config itself.
+	if err := utils.LoadEnv(); err != nil && cmd.name != "config" {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	if c.format == "" && c.output == "" && !c.json {
+		c.format = os.Getenv("REDDMEIT_FORMAT")
+	}
+	if cmd.token && os.Getenv("REDDIT_ACCESS_TOKEN") == "" {
+		fmt.Fprintln(os.Stderr, "Error: missing REDDIT_ACCESS_TOKEN")
+		return ExitError
+	}
+
+	err = runCLICommand(cmd, c, positional)
+	var usage usageError
+	var reddit redditError
+	switch {
+	case errors.As(err, &usage):
+		fmt.Fprintf(os.Stderr, "Error: %v\nusage: reddmeit %s %s\n", err, cmd.name, cmd.args)
+		return ExitUsage
+	case errors.As(err, &reddit):
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitAPI
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// runCLICommand runs cmd, turning a panic from the activity helpers (which
+// still panic on network errors) into an API error.
+func runCLICommand(cmd *cliCommand, c *cliContext, args []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = redditError{fmt.Sprint(r)}
+		}
+	}()
+	return cmd.run(c, args)
+}
+
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: reddmeit [--resume] [--no-cache]  start an interactive session")
+	fmt.Fprintln(w, "       reddmeit --tui [--resume]        start it in the full-screen terminal UI")
+	fmt.Fprintln(w, "       reddmeit --profile NAME ...      use a profile from the config file")
+	fmt.Fprintln(w, "       reddmeit <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(w, "  %-22s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.help)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	fmt.Fprintln(w, "  --json       print JSON on stdout (messages go to stderr)")
+	fmt.Fprintln(w, "  --out FILE   write the plan (recommend, plan show) or export (export) to FILE")
+	fmt.Fprintln(w, "  --dry-run    show what apply, import or undo would change")
+	fmt.Fprintf(w, "  --format F   print the plan (recommend, plan show) as %s\n", strings.Join(utils.Formats, ", "))
+	fmt.Fprintf(w, "  --profile P  use profile P from %s\n", utils.ConfigFile())
+	fmt.Fprintln(w, "  --no-cache   always call the model instead of reusing cached replies")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit codes: 0 success, 1 failure or partially applied changes, 2 bad usage,")
+	fmt.Fprintln(w, "            3 Reddit unreachable or rejected the request (e.g. an expired token).")
+}
+
+// parseInterspersed parses fs while allowing flags after positional
+// arguments, as in `recommend "books" --json`.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// emit prints v as JSON in --json mode and calls text otherwise.
+func (c *cliContext) emit(v any, text func(w io.Writer)) error {
+	if !c.json {
+		text(c.out)
+		return nil
+	}
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func cliSubs(c *cliContext, args []string) error {
+	subscribed, err := FetchSubscriptions(os.Getenv("REDDIT_ACCESS_TOKEN"))
+	if err != nil {
+		return err
+	}
+	names := prefixedNames(subscribed)
+	return c.emit(names, func(w io.Writer) {
+		for _, name := range names {
+			fmt.Fprintln(w, name)
+		}
+	})
+}
+
+func cliActivity(c *cliContext, args []string) error {
+	user := os.Getenv("REDDIT_USERNAME")
+	if user == "" {
+		return fmt.Errorf("missing REDDIT_USERNAME")
+	}
+	token := os.Getenv("REDDIT_ACCESS_TOKEN")
+	subscribed, err := FetchSubscriptions(token)
+	if err != nil {
+		return err
+	}
+	upvoted := FetchUpvotedSubreddits(user, token)
+	commented := FetchCommentedSubreddits(user, token)
+
+	var stats []models.SubredditStats
+	for _, s := range controllers.CombineSubredditStats(subscribed, upvoted, commented) {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return strings.ToLower(stats[i].Name) < strings.ToLower(stats[j].Name) })
+	return c.emit(stats, func(w io.Writer) {
+		fmt.Fprint(w, buildSubsListing(subscribed, upvoted, commented))
+	})
+}
+
+func cliRecommend(c *cliContext, args []string) error {
+	prompt := strings.TrimSpace(strings.Join(args, " "))
+	if prompt == "" {
+		return usageError{"a prompt is required"}
+	}
+	token := os.Getenv("REDDIT_ACCESS_TOKEN")
+	user := os.Getenv("REDDIT_USERNAME")
+
+	session := NewSession()
+	session.History = nil // one-off request
+	session.RedditToken = token
+	session.Account = user
+	session.Log = c.progress
+	var err error
+	if session.Protected, err = utils.LoadProtected(); err != nil {
+		return err
+	}
+	if session.Prefs, err = utils.LoadPreferences(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	intent := session.ClassifyIntent(ctx, prompt)
+
+	subscribed, err := FetchSubscriptions(token)
+	if err != nil {
+		return err
+	}
+	var upvoted, commented map[string]bool
+	if user != "" {
+		upvoted = FetchUpvotedSubreddits(user, token)
+		commented = FetchCommentedSubreddits(user, token)
+	}
+	result, err := session.HandleRequest(ctx, prompt, intent, subscribed, upvoted, commented, nil)
+	if err != nil {
+		return err
+	}
+	if result.Cached {
+		fmt.Fprintln(c.progress, "♻️  Reused a cached reply for this request.")
+	}
+	plan := result.Plan
+	plan.ToRemove = session.Protected.FilterRemovals(plan.ToRemove)
+	if result.ViewOnly {
+		plan = models.RecommendationPlan{}
+	}
+	doc := session.PlanDocument(plan)
+	if result.ViewOnly {
+		doc.Reply = result.Reply
+	}
+
+	if c.output != "" {
+		if err := utils.WritePlanDocument(doc, c.output); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.progress, "✅ Saved to: %s\n", c.output)
+	}
+	if c.format != "" && !result.ViewOnly {
+		return c.render(doc, plan, "")
+	}
+	return c.emit(doc, func(w io.Writer) {
+		if result.ViewOnly {
+			fmt.Fprintln(w, result.Reply)
+			return
+		}
+		utils.PrintPlan(plan)
+	})
+}
+
+func cliPlan(c *cliContext, args []string) error {
+	if len(args) != 2 || (args[0] != "show" && args[0] != "diff") {
+		return usageError{"expected: plan show|diff <file>"}
+	}
+	doc, err := utils.LoadPlanDocument(args[1])
+	if err != nil {
+		return err
+	}
+	plan := utils.PlanFromDocument(doc)
+	if args[0] == "show" {
+		if c.format == "" && !c.json {
+			c.format = utils.FormatForFile(c.output)
+		}
+		if c.format != "" {
+			return c.render(doc, plan, c.output)
+		}
+		return c.emit(doc, func(w io.Writer) {
+			printPlanHeader(w, doc)
+			utils.PrintPlan(plan)
+		})
+	}
+
+	token := os.Getenv("REDDIT_ACCESS_TOKEN")
+	if token == "" {
+		return fmt.Errorf("missing REDDIT_ACCESS_TOKEN")
+	}
+	subscribed, err := FetchSubscriptions(token)
+	if err != nil {
+		return err
+	}
+	diff := utils.DiffPlan(plan, subscribed)
+	return c.emit(diff, func(w io.Writer) { utils.PrintPlanDiff(diff) })
+}
+
+// render writes plan in the --format format, to filename if it isn't "".
+func (c *cliContext) render(doc models.PlanDocument, plan models.RecommendationPlan, filename string) error {
+	format, err := utils.ParseFormat(c.format)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	report := planReport(plan, doc, format, os.Getenv("REDDIT_ACCESS_TOKEN"))
+	if err := writeReport(c.out, filename, format, report); err != nil {
+		return err
+	}
+	if filename != "" {
+		fmt.Fprintf(c.progress, "✅ Wrote %s\n", filename)
+	}
+	return nil
+}
+
+func cliApply(c *cliContext, args []string) error {
+	if len(args) != 1 {
+		return usageError{"expected one plan file"}
+	}
+	plan, err := utils.LoadPlanFromFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Skip changes that already happened since the plan was saved. Without
+	// the current subscriptions that can't be told, so don't guess.
+	subscribed, err := FetchSubscriptions(os.Getenv("REDDIT_ACCESS_TOKEN"))
+	if err != nil {
+		return err
+	}
+	diff := utils.DiffPlan(plan, subscribed)
+	if stale := len(diff.AlreadySubscribed) + len(diff.NotSubscribed); stale > 0 {
+		fmt.Fprintf(c.progress, "⏭️  Skipping %d stale change(s) that already happened.\n", stale)
+	}
+	return c.applyPlan(utils.DropStale(plan, diff))
+}
+
+// applyPlan applies plan (or only prints it with --dry-run) and reports the
+// results. It fails if any change did not go through.
+func (c *cliContext) applyPlan(plan models.RecommendationPlan) error {
+	if c.dryRun {
+		return c.emit(plan, func(w io.Writer) { utils.PrintPlan(plan) })
+	}
+	protected, err := utils.LoadProtected()
+	if err != nil {
+		return err
+	}
+	results := ApplyPlan(plan, os.Getenv("REDDIT_ACCESS_TOKEN"), protected, c.progress)
+	return c.reportResults(results)
+}
+
+func (c *cliContext) reportResults(results []models.ApplyResult) error {
+	if results == nil {
+		results = []models.ApplyResult{}
+	}
+	failed, skipped := ApplyFailures(results), ApplySkipped(results)
+	if err := c.emit(results, func(w io.Writer) {
+		fmt.Fprintf(w, "Applied %d of %d change(s).\n", len(results)-failed-skipped, len(results))
+		if skipped > 0 {
+			fmt.Fprintf(w, "Skipped %d protected subreddit(s).\n", skipped)
+		}
+	}); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d change(s) failed", failed)
+	}
+	return nil
+}
+
+func cliExport(c *cliContext, args []string) error {
+	subscribed, err := FetchSubscriptions(os.Getenv("REDDIT_ACCESS_TOKEN"))
+	if err != nil {
+		return err
+	}
+	export := models.SubscriptionExport{
+		ExportedAt: time.Now(),
+		User:       os.Getenv("REDDIT_USERNAME"),
+		Subreddits: prefixedNames(subscribed),
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if c.output != "" {
+		if err := os.WriteFile(c.output, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.progress, "✅ Exported %d subreddit(s) to %s\n", len(export.Subreddits), c.output)
+		return nil
+	}
+	_, err = c.out.Write(data)
+	return err
+}
+
+func cliImport(c *cliContext, args []string) error {
+	if len(args) != 1 {
+		return usageError{"expected one export file"}
+	}
+	names, err := readSubredditList(args[0])
+	if err != nil {
+		return err
+	}
+	subscribed, err := FetchSubscriptions(os.Getenv("REDDIT_ACCESS_TOKEN"))
+	if err != nil {
+		return err
+	}
+	var plan models.RecommendationPlan
+	for _, name := range names {
+		if !subscribed[strings.TrimPrefix(name, "r/")] && !containsSub(plan.ToAdd, name) {
+			plan.ToAdd = append(plan.ToAdd, name)
+		}
+	}
+	markSource(&plan, "import", 1)
+	fmt.Fprintf(c.progress, "%d of %d subreddit(s) are new.\n", len(plan.ToAdd), len(names))
+	return c.applyPlan(plan)
+}
+
+func cliUndo(c *cliContext, args []string) error {
+	if c.dryRun {
+		records, err := utils.LoadApplyLog()
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return fmt.Errorf("nothing to undo")
+		}
+		plan := InversePlan(records[len(records)-1])
+		return c.emit(plan, func(w io.Writer) { utils.PrintPlan(plan) })
+	}
+	protected, err := utils.LoadProtected()
+	if err != nil {
+		return err
+	}
+	results, err := UndoLastApply(os.Getenv("REDDIT_ACCESS_TOKEN"), protected, c.progress)
+	if err != nil {
+		return err
+	}
+	return c.reportResults(results)
+}
+
+// configReport is what config validate prints with --json.
+type configReport struct {
+	Path     string   `json:"path"`
+	Exists   bool     `json:"exists"`
+	Profiles []string `json:"profiles"`
+	Default  string   `json:"default_profile,omitempty"`
+	Selected string   `json:"selected_profile,omitempty"`
+	Problems []string `json:"problems"`
+}
+
+func cliConfig(c *cliContext, args []string) error {
+	if len(args) != 1 || args[0] != "validate" {
+		return usageError{"expected: config validate"}
+	}
+	cfg, err := utils.LoadConfig()
+	report := configReport{Path: cfg.Path, Profiles: cfg.ProfileNames(), Default: cfg.Default, Problems: []string{}}
+	_, statErr := os.Stat(cfg.Path)
+	report.Exists = statErr == nil
+
+	if err != nil {
+		// The file can't be decoded, so there is nothing more to check.
+		report.Problems = append(report.Problems, err.Error())
+	} else {
+		for _, problem := range cfg.Validate() {
+			report.Problems = append(report.Problems, problem.Error())
+		}
+		if selected, _, err := cfg.Profile(""); err != nil {
+			report.Problems = append(report.Problems, err.Error())
+		} else {
+			report.Selected = selected
+			// Loading the profile also catches unset *_env variables and
+			// an unreadable env_file or .env.
+			if err := utils.LoadEnv(); err != nil && len(report.Problems) == 0 {
+				report.Problems = append(report.Problems, strings.Split(err.Error(), "\n")...)
+			}
+		}
+	}
+
+	err = c.emit(report, func(w io.Writer) {
+		switch {
+		case !report.Exists:
+			fmt.Fprintf(w, "ℹ️  No config file at %s; settings come from the environment only.\n", report.Path)
+		case len(report.Problems) == 0:
+			fmt.Fprintf(w, "✅ %s is valid.\n", report.Path)
+		}
+		if len(report.Profiles) > 0 {
+			fmt.Fprintf(w, "   Profiles: %s\n", strings.Join(report.Profiles, ", "))
+		}
+		if report.Selected != "" {
+			fmt.Fprintf(w, "   Using: %s\n", report.Selected)
+		}
+		for _, problem := range report.Problems {
+			fmt.Fprintf(w, "❌ %s\n", problem)
+		}
+	})
+	if err == nil && len(report.Problems) > 0 {
+		err = fmt.Errorf("%d problem(s) in %s", len(report.Problems), report.Path)
+	}
+	return err
+}
+
+func cliServe(c *cliContext, args []string) error {
+	if len(args) > 0 {
+		return usageError{"serve takes no arguments"}
+	}
+	addr := c.addr
+	if addr == "" {
+		addr = ServerAddr()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return NewServer().ListenAndServe(ctx, addr)
+}
+
+// printPlanHeader prints where a saved plan came from.
+func printPlanHeader(w io.Writer, doc models.PlanDocument) {
+	fmt.Fprintf(w, "Created:  %s\n", doc.CreatedAt.Local().Format("2006-01-02 15:04"))
+	if doc.Account != "" {
+		fmt.Fprintf(w, "Account:  u/%s\n", doc.Account)
+	}
+	if doc.Model != "" {
+		fmt.Fprintf(w, "Model:    %s\n", doc.Model)
+	}
+	if doc.PromptVersion != "" {
+		fmt.Fprintf(w, "Prompts:  version %s\n", doc.PromptVersion)
+	}
+	for _, prompt := range doc.Prompts {
+		fmt.Fprintf(w, "Asked:    %q\n", prompt)
+	}
+	fmt.Fprintln(w)
+}
+
+// readSubredditList reads an export written by `export`, or a plain list
+// with one subreddit per line.
+func readSubredditList(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var export models.SubscriptionExport
+	if json.Unmarshal(data, &export) == nil {
+		return normalizeArgs(export.Subreddits)
+	}
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			names = append(names, line)
+		}
+	}
+	return normalizeArgs(names)
+}
+
+// prefixedNames returns a subreddit set as sorted r/name strings.
+func prefixedNames(subs map[string]bool) []string {
+	names := []string{}
+	for _, name := range sortedNames(subs) {
+		names = append(names, "r/"+name)
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names
+}
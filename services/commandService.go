@@ -0,0 +1,922 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/HenryArin/ReddmeitAlpha/controllers"
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+)
+
+// interactiveState is the terminal side of a session: the Reddit account,
+// the undo stack and how to ask the user for confirmation.
+type interactiveState struct {
+	*Session
+
+	token string
+	user  string
+	undo  []models.RecommendationPlan
+	ask   func(question string) (string, error)
+
+	// topics the user asked about this session; they become liked topics
+	// once a plan is applied.
+	topics []string
+
+	// keepSaved is set while a save from an earlier run, not resumed,
+	// would be overwritten by the next autosave.
+	keepSaved bool
+
+	subscribed map[string]bool
+	upvoted    map[string]bool
+	commented  map[string]bool
+}
+
+// refreshActivity fetches the user's subscriptions and activity from Reddit.
+func (st *interactiveState) refreshActivity() {
+	st.subscribed = FetchSubscribedSubreddits(st.token)
+	st.upvoted = FetchUserActivity(st.user, st.token, "upvoted")
+	st.commented = FetchUserActivity(st.user, st.token, "comments")
+}
+
+// subscriptions returns the cached subscriptions, fetching them on first use.
+func (st *interactiveState) subscriptions() map[string]bool {
+	if st.subscribed == nil {
+		st.refreshActivity()
+	}
+	return st.subscribed
+}
+
+// learnFromFeedback remembers subreddits and topics the user rejected so
+// they aren't suggested again in this session, and notes the topics they
+// asked about. A passing "not art" shouldn't rule art out for good, so
+// only /block saves exclusions to the preference profile.
+func (st *interactiveState) learnFromFeedback(intent controllers.Intent) {
+	var learned []string
+	for _, name := range intent.Slots.ExcludedSubreddits {
+		if utils.AddPreference(&st.Skipped.BlockedSubs, "r/"+name) {
+			learned = append(learned, "r/"+name)
+		}
+	}
+	for _, topic := range intent.Slots.ExcludedTopics {
+		if utils.AddPreference(&st.Skipped.BlockedTopics, topic) {
+			learned = append(learned, topic)
+		}
+	}
+	if len(learned) > 0 {
+		fmt.Printf("📝 Skipping %s for the rest of this session (/block to make it permanent).\n", strings.Join(learned, ", "))
+	}
+	if intent.Type == controllers.NewPrompt {
+		for _, topic := range intent.Slots.Topics {
+			utils.AddPreference(&st.topics, topic)
+		}
+	}
+}
+
+// learnAccepted records the session's topics as liked once a plan built
+// from them has been applied.
+func (st *interactiveState) learnAccepted() {
+	changed := false
+	for _, topic := range st.topics {
+		changed = utils.AddPreference(&st.Prefs.LikedTopics, topic) || changed
+	}
+	st.topics = nil
+	if changed {
+		st.savePrefs()
+	}
+}
+
+func (st *interactiveState) savePrefs() {
+	if err := utils.SavePreferences(st.Prefs); err != nil {
+		fmt.Printf("⚠️  Failed to save preferences: %v\n", err)
+	}
+}
+
+// autosave writes the session so it can be resumed after quitting or a
+// crash. Nothing is written until the session has a plan or history, so
+// starting a new session doesn't overwrite an earlier save.
+func (st *interactiveState) autosave() {
+	if st.Empty() {
+		return
+	}
+	if st.keepSaved {
+		// An earlier session the user didn't resume is set aside rather
+		// than overwritten.
+		st.keepSaved = false
+		if err := utils.RotateSessionState(); err != nil {
+			fmt.Printf("⚠️  Failed to keep the earlier session: %v\n", err)
+			return
+		}
+		fmt.Println("💾 Your earlier saved session was kept; /resume previous brings it back.")
+	}
+	state := st.State()
+	state.Undo = st.undo
+	state.Topics = st.topics
+	if err := utils.SaveSessionState(state); err != nil {
+		fmt.Printf("⚠️  Failed to autosave session: %v\n", err)
+	}
+}
+
+// noteSavedSession reports a saved session left from an earlier run, so
+// that the first autosave of a new session sets it aside instead of
+// overwriting it.
+func (st *interactiveState) noteSavedSession() (models.SessionState, bool) {
+	saved, ok, _ := utils.LoadSessionState()
+	st.keepSaved = ok
+	return saved, ok
+}
+
+// resume loads the saved session into st; with previous set, the one set
+// aside by the first autosave of this session.
+func (st *interactiveState) resume(previous bool) error {
+	load, file := utils.LoadSessionState, utils.SessionFile()
+	if previous {
+		load, file = utils.LoadPreviousSessionState, utils.PreviousSessionFile()
+	}
+	state, ok, err := load()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no saved session in %s", file)
+	}
+	st.keepSaved = false
+	st.Restore(state)
+	st.undo = state.Undo
+	st.topics = state.Topics
+	fmt.Printf("📂 Resumed the session saved %s.\n", state.SavedAt.Local().Format("2006-01-02 15:04"))
+	utils.PrintPlan(st.Plan)
+	return nil
+}
+
+// confirm asks a yes/no question; anything but "yes" counts as no.
+func (st *interactiveState) confirm(question string) bool {
+	yes, err := st.askYesNo(question)
+	return err == nil && yes
+}
+
+// askYesNo is confirm for callers that treat Ctrl-C differently from "no":
+// the error is utils.ErrInterrupted when the question was interrupted.
+func (st *interactiveState) askYesNo(question string) (bool, error) {
+	answer, err := st.ask(question)
+	if err != nil {
+		return false, err
+	}
+	return strings.ToLower(strings.TrimSpace(answer)) == "yes", nil
+}
+
+// savePlan writes plan, with the session's metadata, to the plan directory.
+func (st *interactiveState) savePlan(plan models.RecommendationPlan, label string) {
+	path, err := utils.SavePlanDocument(st.PlanDocument(plan), label)
+	if err != nil {
+		fmt.Printf("❌ Failed to save plan: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ Saved to: %s\n", path)
+}
+
+// markUserItem records that the user added sub to the plan by hand.
+func markUserItem(plan *models.RecommendationPlan, sub string) {
+	if plan.Sources == nil {
+		plan.Sources = map[string]string{}
+	}
+	if plan.RequestConfidence == nil {
+		plan.RequestConfidence = map[string]float64{}
+	}
+	plan.Sources[sub] = "user"
+	plan.RequestConfidence[sub] = 1
+}
+
+// mergeSuggestion merges a new suggestion into the plan, reporting (or,
+// under the ask policy, asking about) subreddits it flips between add and
+// remove.
+func (st *interactiveState) mergeSuggestion(plan models.RecommendationPlan) {
+	var conflicts []utils.MergeConflict
+	st.Plan, conflicts = utils.MergePlans(st.Plan, plan, utils.MergeOptions{
+		Policy:    st.MergePolicy,
+		Protected: st.Protected,
+		Resolve:   st.resolveConflict,
+	})
+	for _, c := range conflicts {
+		fmt.Println(utils.DescribeConflict(c))
+	}
+}
+
+func (st *interactiveState) resolveConflict(c utils.MergeConflict) string {
+	question := fmt.Sprintf("⚖️  %s was going to be %sed, but the new suggestion is to %s it. Keep [a]dd, [r]emove or [d]rop it?",
+		c.Subreddit, strings.TrimSuffix(c.Earlier, "e"), c.Later)
+	for {
+		answer, err := st.ask(question)
+		if err != nil {
+			return c.Later
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "a", "add":
+			return "add"
+		case "r", "remove":
+			return "remove"
+		case "d", "drop":
+			return ""
+		}
+	}
+}
+
+// snapshot records the current plan so the next change can be undone.
+func (st *interactiveState) snapshot() {
+	st.undo = append(st.undo, utils.ClonePlan(st.Plan))
+}
+
+type slashCommand struct {
+	name    string
+	args    string // usage shown by /help
+	help    string
+	subArgs bool // arguments are subreddit names
+	run     func(st *interactiveState, args []string) error
+}
+
+var slashCommands []slashCommand
+
+func init() {
+	slashCommands = []slashCommand{
+		{"/add", "r/x ...", "Add subreddits to the plan", true, cmdAdd},
+		{"/remove", "r/x ...", "Plan to unsubscribe from subreddits", true, cmdRemove},
+		{"/keep", "r/x ...", "Take subreddits off the removal list", true, cmdKeep},
+		{"/drop", "r/x ...", "Drop subreddits from the plan entirely", true, cmdDrop},
+		{"/plan", "", "Show the current plan", false, cmdPlan},
+		{"/subs", "", "Show your current subreddits", false, cmdSubs},
+		{"/apply", "", "Save and apply the current plan now", false, cmdApply},
+		{"/save", "[name]", "Save the current plan to logs/", false, cmdSave},
+		{"/load", "<file>", "Replace the current plan with a saved one", false, cmdLoad},
+		{"/edit", "", "Edit the plan in $EDITOR", false, cmdEdit},
+		{"/export", "<format> [file] | <file>", "Write the plan as markdown, html, csv, json or text", false, cmdExport},
+		{"/review", "", "Approve changes one by one, then apply them", false, cmdReview},
+		{"/resume", "[previous]", "Continue the last autosaved session, or the one it replaced", false, cmdResume},
+		{"/undo", "", "Undo the last change to the plan", false, cmdUndo},
+		{"/protect", "r/x ...", "Never unsubscribe from these subreddits", true, cmdProtect},
+		{"/unprotect", "r/x ...", "Take subreddits off the protected list", true, cmdUnprotect},
+		{"/protected", "", "Show the protected list", false, cmdProtected},
+		{"/prefs", "", "Show learned preferences", false, cmdPrefs},
+		{"/block", "r/x ... | topic", "Never suggest these subreddits or this topic", false, cmdBlock},
+		{"/unblock", "r/x ... | topic", "Allow a blocked subreddit or topic again", false, cmdUnblock},
+		{"/like", "topic", "Remember a topic you like", false, cmdLike},
+		{"/unlike", "topic", "Forget a liked topic", false, cmdUnlike},
+		{"/policy", "[latest|ask|drop]", "Show or set how add/remove conflicts are merged", false, cmdPolicy},
+		{"/help", "", "List commands", false, cmdHelp},
+	}
+}
+
+// IsSlashCommand reports whether input should be handled as a command
+// rather than sent to the assistant.
+func IsSlashCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), "/")
+}
+
+// runSlashCommand executes one command line such as "/add r/books r/manga".
+func runSlashCommand(st *interactiveState, line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	name := strings.ToLower(fields[0])
+	for _, cmd := range slashCommands {
+		if cmd.name == name {
+			return cmd.run(st, fields[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %s (try /help)", fields[0])
+}
+
+// normalizeArgs validates subreddit arguments and returns them as r/name.
+func normalizeArgs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("name at least one subreddit, e.g. r/books")
+	}
+	var subs []string
+	for _, arg := range args {
+		for _, part := range strings.Split(arg, ",") {
+			if part == "" {
+				continue
+			}
+			sub, err := utils.NormalizeSubreddit(part)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func cmdAdd(st *interactiveState, args []string) error {
+	subs, err := normalizeArgs(args)
+	if err != nil {
+		return err
+	}
+	st.snapshot()
+	for _, sub := range subs {
+		st.Plan.ToRemove = withoutSub(st.Plan.ToRemove, sub)
+		if !containsSub(st.Plan.ToAdd, sub) {
+			st.Plan.ToAdd = append(st.Plan.ToAdd, sub)
+			markUserItem(&st.Plan, sub)
+		}
+		fmt.Printf("➕ %s will be added.\n", sub)
+	}
+	return nil
+}
+
+func cmdRemove(st *interactiveState, args []string) error {
+	subs, err := normalizeArgs(args)
+	if err != nil {
+		return err
+	}
+	st.snapshot()
+	for _, sub := range subs {
+		if st.Protected.Contains(sub) {
+			fmt.Printf("🛡️  Not removing %s: it is on your protected list (/unprotect %s to allow it).\n", sub, sub)
+			continue
+		}
+		st.Plan.ToAdd = withoutSub(st.Plan.ToAdd, sub)
+		if !containsSub(st.Plan.ToRemove, sub) {
+			st.Plan.ToRemove = append(st.Plan.ToRemove, sub)
+			markUserItem(&st.Plan, sub)
+		}
+		fmt.Printf("➖ %s will be removed.\n", sub)
+	}
+	return nil
+}
+
+func cmdKeep(st *interactiveState, args []string) error {
+	subs, err := normalizeArgs(args)
+	if err != nil {
+		return err
+	}
+	st.snapshot()
+	for _, sub := range subs {
+		st.Plan.ToRemove = withoutSub(st.Plan.ToRemove, sub)
+		fmt.Printf("🛑 %s will be kept.\n", sub)
+	}
+	return nil
+}
+
+func cmdDrop(st *interactiveState, args []string) error {
+	subs, err := normalizeArgs(args)
+	if err != nil {
+		return err
+	}
+	st.snapshot()
+	for _, sub := range subs {
+		st.Plan.ToAdd = withoutSub(st.Plan.ToAdd, sub)
+		st.Plan.ToRemove = withoutSub(st.Plan.ToRemove, sub)
+		fmt.Printf("🗑️  %s dropped from the plan.\n", sub)
+	}
+	return nil
+}
+
+func cmdPlan(st *interactiveState, args []string) error {
+	fmt.Println("📋 Current plan so far:")
+	utils.PrintPlan(st.Plan)
+	return nil
+}
+
+func cmdSubs(st *interactiveState, args []string) error {
+	st.refreshActivity()
+	fmt.Println(buildSubsListing(st.subscribed, st.upvoted, st.commented))
+	return nil
+}
+
+func cmdApply(st *interactiveState, args []string) error {
+	if len(st.Plan.ToAdd) == 0 && len(st.Plan.ToRemove) == 0 {
+		fmt.Println("= No changes needed.")
+		return nil
+	}
+	utils.PrintPlan(st.Plan)
+	if !st.confirm("⚠️  Apply these changes? (yes/no)") {
+		fmt.Println("❌ Changes canceled.")
+		return nil
+	}
+	st.savePlan(st.Plan, "interactive_session")
+	ApplyPlan(st.Plan, st.token, st.Protected, os.Stdout)
+	st.learnAccepted()
+	st.Plan = models.RecommendationPlan{}
+	st.subscribed = nil
+	return nil
+}
+
+func cmdReview(st *interactiveState, args []string) error {
+	if len(st.Plan.ToAdd) == 0 && len(st.Plan.ToRemove) == 0 {
+		fmt.Println("= No changes needed.")
+		return nil
+	}
+	approved, ok := st.review()
+	if !ok {
+		return nil
+	}
+	st.savePlan(approved, "interactive_session")
+	ApplyPlan(approved, st.token, st.Protected, os.Stdout)
+	st.learnAccepted()
+	st.subscribed = nil
+	return nil
+}
+
+func cmdEdit(st *interactiveState, args []string) error {
+	text := utils.FormatPlanText(st.Plan)
+	for {
+		edited, err := editText(text)
+		if err != nil {
+			return err
+		}
+		plan, err := utils.ParsePlanText(edited, st.Plan)
+		if err != nil {
+			fmt.Printf("❌ The edited plan has problems:\n%v\n", err)
+			if !st.confirm("Edit it again? (yes/no)") {
+				fmt.Println("Plan left unchanged.")
+				return nil
+			}
+			// Reopen what the user wrote rather than starting over.
+			text = edited
+			continue
+		}
+		plan.ToRemove = st.Protected.FilterRemovals(plan.ToRemove)
+		changes := planChanges(st.Plan, plan)
+		if len(changes) == 0 {
+			fmt.Println("= No changes.")
+			return nil
+		}
+		st.snapshot()
+		plan.Conversation = st.Plan.Conversation
+		st.Plan = plan
+		fmt.Println("✏️  Updated the plan:")
+		for _, change := range changes {
+			fmt.Println("   " + change)
+		}
+		return nil
+	}
+}
+
+// editText opens text in the user's editor ($VISUAL, $EDITOR or vi) and
+// returns what was saved.
+func editText(text string) (string, error) {
+	f, err := os.CreateTemp("", "reddmeit-plan-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	// Allow editors with arguments, such as "code --wait".
+	fields := editorCommand()
+	cmd := exec.Command(fields[0], append(fields[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s: %w", fields[0], err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// editorCommand splits $VISUAL or $EDITOR into a command and its
+// arguments, falling back to vi when neither holds anything but spaces.
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// planChanges describes how after differs from before, one line per
+// change: subreddits added, dropped or flipped, and reasons or categories
+// edited on the ones that stayed.
+func planChanges(before, after models.RecommendationPlan) []string {
+	var changes []string
+	for _, sub := range after.ToAdd {
+		switch {
+		case containsSub(before.ToRemove, sub):
+			changes = append(changes, fmt.Sprintf("%s: remove → add", sub))
+		case !containsSub(before.ToAdd, sub):
+			changes = append(changes, fmt.Sprintf("+ %s", sub))
+		}
+	}
+	for _, sub := range after.ToRemove {
+		switch {
+		case containsSub(before.ToAdd, sub):
+			changes = append(changes, fmt.Sprintf("%s: add → remove", sub))
+		case !containsSub(before.ToRemove, sub):
+			changes = append(changes, fmt.Sprintf("- %s", sub))
+		}
+	}
+	for _, sub := range append(append([]string(nil), before.ToAdd...), before.ToRemove...) {
+		if !containsSub(after.ToAdd, sub) && !containsSub(after.ToRemove, sub) {
+			changes = append(changes, fmt.Sprintf("dropped %s", sub))
+		}
+	}
+	for _, sub := range append(append([]string(nil), after.ToAdd...), after.ToRemove...) {
+		key, ok := findSub(before, sub)
+		if !ok {
+			continue
+		}
+		if was, now := before.Categories[key], after.Categories[sub]; was != now {
+			if now == "" {
+				changes = append(changes, fmt.Sprintf("%s: category cleared", sub))
+			} else {
+				changes = append(changes, fmt.Sprintf("%s: category → %s", sub, now))
+			}
+		}
+		if was, now := before.Explanations[key], after.Explanations[sub]; sameText(was) != sameText(now) {
+			if now == "" {
+				changes = append(changes, fmt.Sprintf("%s: reason cleared", sub))
+			} else {
+				changes = append(changes, fmt.Sprintf("%s: reason → %s", sub, now))
+			}
+		}
+	}
+	return changes
+}
+
+// findSub returns the name plan uses for sub, if it lists it at all.
+func findSub(plan models.RecommendationPlan, sub string) (string, bool) {
+	for _, list := range [][]string{plan.ToAdd, plan.ToRemove} {
+		for _, s := range list {
+			if utils.SameSubreddit(s, sub) {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// sameText collapses whitespace, which the plan text format does not keep,
+// so an untouched reason compares equal after a round trip.
+func sameText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func cmdSave(st *interactiveState, args []string) error {
+	name := "interactive_session"
+	if len(args) > 0 {
+		name = strings.Join(args, "_")
+	}
+	st.savePlan(st.Plan, name)
+	return nil
+}
+
+func cmdLoad(st *interactiveState, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /load <file>")
+	}
+	plan, err := utils.LoadPlanFromFile(args[0])
+	if err != nil {
+		return err
+	}
+	subscribed, err := FetchSubscriptions(st.token)
+	if err != nil {
+		return err
+	}
+	st.subscribed = subscribed
+	st.snapshot()
+	plan.ToRemove = st.Protected.FilterRemovals(plan.ToRemove)
+	diff := utils.DiffPlan(plan, subscribed)
+	st.Plan = utils.DropStale(plan, diff)
+	fmt.Printf("📂 Loaded %s:\n", args[0])
+	utils.PrintPlanDiff(diff)
+	return nil
+}
+
+func cmdExport(st *interactiveState, args []string) error {
+	var format, filename string
+	switch len(args) {
+	case 1:
+		if format = utils.FormatForFile(args[0]); format != "" {
+			filename = args[0]
+		} else {
+			format = args[0]
+		}
+	case 2:
+		format, filename = args[0], args[1]
+	default:
+		return fmt.Errorf("usage: /export <format> [file] (formats: %s)", strings.Join(utils.Formats, ", "))
+	}
+	format, err := utils.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	report := planReport(st.Plan, st.PlanDocument(st.Plan), format, st.token)
+	if err := writeReport(os.Stdout, filename, format, report); err != nil {
+		return err
+	}
+	if filename != "" {
+		fmt.Printf("✅ Wrote %s\n", filename)
+	}
+	return nil
+}
+
+func cmdUndo(st *interactiveState, args []string) error {
+	if len(st.undo) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+	st.Plan = st.undo[len(st.undo)-1]
+	st.undo = st.undo[:len(st.undo)-1]
+	fmt.Println("↩️  Undone. Current plan:")
+	utils.PrintPlan(st.Plan)
+	return nil
+}
+
+func cmdProtect(st *interactiveState, args []string) error {
+	subs, err := normalizeArgs(args)
+	if err != nil {
+		return err
+	}
+	st.snapshot()
+	for _, sub := range subs {
+		if err := st.Protected.Add(sub); err != nil {
+			return err
+		}
+		st.Plan.ToRemove = withoutSub(st.Plan.ToRemove, sub)
+		fmt.Printf("🛡️  %s is protected and will never be removed.\n", sub)
+	}
+	return nil
+}
+
+func cmdUnprotect(st *interactiveState, args []string) error {
+	subs, err := normalizeArgs(args)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if err := st.Protected.Remove(sub); err != nil {
+			return err
+		}
+		fmt.Printf("🔓 %s is no longer protected.\n", sub)
+	}
+	return nil
+}
+
+func cmdProtected(st *interactiveState, args []string) error {
+	names := st.Protected.Names()
+	if len(names) == 0 {
+		fmt.Println("🛡️  No protected subreddits. Use /protect r/x to add one.")
+		return nil
+	}
+	fmt.Println("🛡️  Protected subreddits:")
+	for _, sub := range names {
+		fmt.Printf(" = %s\n", sub)
+	}
+	return nil
+}
+
+func cmdPrefs(st *interactiveState, args []string) error {
+	show := func(title string, items []string) {
+		if len(items) == 0 {
+			fmt.Printf("%s: (none)\n", title)
+			return
+		}
+		fmt.Printf("%s: %s\n", title, strings.Join(items, ", "))
+	}
+	show("👍 Liked topics", st.Prefs.LikedTopics)
+	show("🚫 Blocked topics", st.Prefs.BlockedTopics)
+	show("🚫 Blocked subreddits", st.Prefs.BlockedSubs)
+	if skipped := append(append([]string(nil), st.Skipped.BlockedSubs...), st.Skipped.BlockedTopics...); len(skipped) > 0 {
+		show("⏭️  Skipped this session", skipped)
+	}
+	return nil
+}
+
+// prefArgs splits arguments into subreddit names, when they all look like
+// r/name, or a single (possibly multi-word) topic.
+func prefArgs(args []string) (subs []string, topic string, err error) {
+	if len(args) == 0 {
+		return nil, "", fmt.Errorf("name a subreddit (r/x) or a topic")
+	}
+	if strings.HasPrefix(strings.ToLower(args[0]), "r/") {
+		subs, err = normalizeArgs(args)
+		return subs, "", err
+	}
+	return nil, strings.ToLower(strings.Join(args, " ")), nil
+}
+
+func cmdBlock(st *interactiveState, args []string) error {
+	subs, topic, err := prefArgs(args)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		utils.AddPreference(&st.Prefs.BlockedSubs, sub)
+		utils.RemovePreference(&st.Skipped.BlockedSubs, sub)
+		st.Plan.ToAdd = withoutSub(st.Plan.ToAdd, sub)
+		fmt.Printf("🚫 %s will not be suggested.\n", sub)
+	}
+	if topic != "" {
+		utils.AddPreference(&st.Prefs.BlockedTopics, topic)
+		utils.RemovePreference(&st.Skipped.BlockedTopics, topic)
+		utils.RemovePreference(&st.Prefs.LikedTopics, topic)
+		fmt.Printf("🚫 Subreddits about %q will not be suggested.\n", topic)
+	}
+	st.savePrefs()
+	return nil
+}
+
+func cmdUnblock(st *interactiveState, args []string) error {
+	subs, topic, err := prefArgs(args)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		skipped := utils.RemovePreference(&st.Skipped.BlockedSubs, sub)
+		if !utils.RemovePreference(&st.Prefs.BlockedSubs, sub) && !skipped {
+			return fmt.Errorf("%s is not blocked", sub)
+		}
+		fmt.Printf("✅ %s can be suggested again.\n", sub)
+	}
+	if topic != "" {
+		skipped := utils.RemovePreference(&st.Skipped.BlockedTopics, topic)
+		if !utils.RemovePreference(&st.Prefs.BlockedTopics, topic) && !skipped {
+			return fmt.Errorf("%q is not blocked", topic)
+		}
+		fmt.Printf("✅ Subreddits about %q can be suggested again.\n", topic)
+	}
+	st.savePrefs()
+	return nil
+}
+
+func cmdLike(st *interactiveState, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: /like <topic>")
+	}
+	topic := strings.ToLower(strings.Join(args, " "))
+	utils.AddPreference(&st.Prefs.LikedTopics, topic)
+	utils.RemovePreference(&st.Prefs.BlockedTopics, topic)
+	st.savePrefs()
+	fmt.Printf("👍 Noted that you like %q.\n", topic)
+	return nil
+}
+
+func cmdUnlike(st *interactiveState, args []string) error {
+	topic := strings.ToLower(strings.Join(args, " "))
+	if !utils.RemovePreference(&st.Prefs.LikedTopics, topic) {
+		return fmt.Errorf("%q is not a liked topic", topic)
+	}
+	st.savePrefs()
+	fmt.Printf("👋 Forgot that you like %q.\n", topic)
+	return nil
+}
+
+func cmdResume(st *interactiveState, args []string) error {
+	previous := len(args) > 0 && args[0] == "previous"
+	if len(args) > 0 && !previous {
+		return fmt.Errorf("usage: /resume [previous]")
+	}
+	if !st.Empty() && !st.confirm("Replace the current session with the saved one? (yes/no)") {
+		return nil
+	}
+	return st.resume(previous)
+}
+
+func cmdPolicy(st *interactiveState, args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("⚖️  Merge policy: %s\n", st.MergePolicy)
+		return nil
+	}
+	policy, err := utils.ParseMergePolicy(args[0])
+	if err != nil {
+		return err
+	}
+	st.MergePolicy = policy
+	fmt.Printf("⚖️  Merge policy set to %s.\n", policy)
+	return nil
+}
+
+func cmdHelp(st *interactiveState, args []string) error {
+	fmt.Println("Commands:")
+	for _, cmd := range slashCommands {
+		usage := strings.TrimSpace(cmd.name + " " + cmd.args)
+		fmt.Printf("  %-18s %s\n", usage, cmd.help)
+	}
+	fmt.Println("Anything else is sent to the assistant. Press Tab to complete commands and subreddit names.")
+	return nil
+}
+
+// CompleteCommand returns completions for the last word of a partially
+// typed line: command names, subreddit names (from subscriptions and the
+// current plan) for subreddit arguments or r/ words in free text, and saved
+// plan files for /load.
+func (st *interactiveState) CompleteCommand(line string) []string {
+	if !IsSlashCommand(line) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasSuffix(line, " ") || !strings.HasPrefix(strings.ToLower(fields[len(fields)-1]), "r/") {
+			return nil
+		}
+		return matchSubs(fields[len(fields)-1], st.completionNames(""))
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 1 && !strings.HasSuffix(line, " ") {
+		var out []string
+		for _, cmd := range slashCommands {
+			if strings.HasPrefix(cmd.name, strings.ToLower(fields[0])) {
+				out = append(out, cmd.name)
+			}
+		}
+		return out
+	}
+
+	word := ""
+	if !strings.HasSuffix(line, " ") {
+		word = fields[len(fields)-1]
+	}
+	name := strings.ToLower(fields[0])
+	if name == "/load" {
+		files, _ := filepath.Glob(word + "*")
+		if word == "" {
+			files, _ = filepath.Glob(filepath.Join("logs", "*.json"))
+		}
+		return files
+	}
+	for _, cmd := range slashCommands {
+		if cmd.name == name && cmd.subArgs {
+			return matchSubs(word, st.completionNames(name))
+		}
+	}
+	return nil
+}
+
+// completionNames lists the subreddit names that make sense for cmd.
+func (st *interactiveState) completionNames(cmd string) []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(sub string) {
+		sub = "r/" + strings.TrimPrefix(sub, "r/")
+		if !seen[strings.ToLower(sub)] {
+			seen[strings.ToLower(sub)] = true
+			names = append(names, sub)
+		}
+	}
+	switch cmd {
+	case "/unblock":
+		names = append(names, st.Prefs.BlockedSubs...)
+	case "/unprotect":
+		names = append(names, st.Protected.Names()...)
+	case "/keep":
+		for _, sub := range st.Plan.ToRemove {
+			add(sub)
+		}
+	case "/drop":
+		for _, sub := range st.Plan.ToAdd {
+			add(sub)
+		}
+		for _, sub := range st.Plan.ToRemove {
+			add(sub)
+		}
+	default:
+		for _, sub := range st.Plan.ToAdd {
+			add(sub)
+		}
+		for sub := range st.subscriptions() {
+			add(sub)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func matchSubs(word string, names []string) []string {
+	prefix := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(word, "/"), "r/"))
+	var out []string
+	for _, name := range names {
+		if strings.HasPrefix(strings.ToLower(strings.TrimPrefix(name, "r/")), prefix) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func containsSub(list []string, sub string) bool {
+	for _, s := range list {
+		if utils.SameSubreddit(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutSub(list []string, sub string) []string {
+	var out []string
+	for _, s := range list {
+		if !utils.SameSubreddit(s, sub) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
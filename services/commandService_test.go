@@ -0,0 +1,85 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+)
+
+func TestPlanChanges(t *testing.T) {
+	before := models.RecommendationPlan{
+		ToAdd:        []string{"r/books", "r/woodworking"},
+		ToRemove:     []string{"r/news"},
+		Explanations: map[string]string{"r/books": "You read a lot", "r/woodworking": "Matches\nyour hobby"},
+		Categories:   map[string]string{"r/books": "📚 Reading"},
+	}
+	tests := []struct {
+		name string
+		edit func(p *models.RecommendationPlan)
+		want []string
+	}{
+		{"unchanged", func(p *models.RecommendationPlan) {}, nil},
+		{
+			"reason edited",
+			func(p *models.RecommendationPlan) { p.Explanations["r/books"] = "Classics only" },
+			[]string{"r/books: reason → Classics only"},
+		},
+		{
+			"reason cleared",
+			func(p *models.RecommendationPlan) { delete(p.Explanations, "r/books") },
+			[]string{"r/books: reason cleared"},
+		},
+		{
+			"category moved",
+			func(p *models.RecommendationPlan) { p.Categories["r/news"] = "📰 News" },
+			[]string{"r/news: category → 📰 News"},
+		},
+		{
+			"flipped and dropped",
+			func(p *models.RecommendationPlan) {
+				p.ToAdd = []string{"r/books", "r/woodworking", "r/news"}
+				p.ToRemove = nil
+			},
+			[]string{"r/news: remove → add"},
+		},
+		{
+			"added",
+			func(p *models.RecommendationPlan) { p.ToAdd = append(p.ToAdd, "r/pics") },
+			[]string{"+ r/pics"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Round-trip through the editor format, as /edit does.
+			after, err := utils.ParsePlanText(utils.FormatPlanText(before), before)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(&after)
+			if got := planChanges(before, after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	tests := []struct {
+		visual, editor string
+		want           []string
+	}{
+		{"", "", []string{"vi"}},
+		{"  ", "\t", []string{"vi"}},
+		{" ", "nano", []string{"nano"}},
+		{"code --wait", "nano", []string{"code", "--wait"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("VISUAL", tt.visual)
+		t.Setenv("EDITOR", tt.editor)
+		if got := editorCommand(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("editorCommand() with VISUAL=%q EDITOR=%q = %q, want %q", tt.visual, tt.editor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/prompts"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultMaxMessages = 12
+
+// Conversation is the bounded chat history of an interactive session. Only
+// the user's own words and the model's replies are kept; the system prompt
+// and subscription context are rebuilt on every turn. Once the history grows
+// past MaxMessages the oldest turns are folded into Summary.
+type Conversation struct {
+	Summary     string
+	Messages    []openai.ChatCompletionMessage
+	MaxMessages int
+}
+
+// NewConversation returns an empty history with the default bound.
+func NewConversation() *Conversation {
+	return &Conversation{MaxMessages: defaultMaxMessages}
+}
+
+// ImportConversation rebuilds a history saved with Export; a leading system
+// message becomes the summary.
+func ImportConversation(messages []models.ChatMessage) *Conversation {
+	c := NewConversation()
+	for i, m := range messages {
+		if i == 0 && m.Role == openai.ChatMessageRoleSystem {
+			c.Summary = m.Content
+			continue
+		}
+		c.Add(m.Role, m.Content)
+	}
+	return c
+}
+
+// Add appends one message to the history.
+func (c *Conversation) Add(role, content string) {
+	c.Messages = append(c.Messages, openai.ChatCompletionMessage{Role: role, Content: content})
+}
+
+// Context returns the summary (as a system message) followed by the recent
+// messages, ready to be placed between the system prompt and the new turn.
+func (c *Conversation) Context() []openai.ChatCompletionMessage {
+	if c == nil {
+		return nil
+	}
+	var out []openai.ChatCompletionMessage
+	if c.Summary != "" {
+		out = append(out, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: "Summary of the earlier conversation:\n" + c.Summary,
+		})
+	}
+	return append(out, c.Messages...)
+}
+
+// Compact summarizes the oldest half of the history when it has grown past
+// MaxMessages, keeping the most recent turns verbatim. The summary prompt
+// comes from set.
+func (c *Conversation) Compact(ctx context.Context, client *openai.Client, model string, set *prompts.Set) error {
+	if c == nil || c.MaxMessages <= 0 || len(c.Messages) <= c.MaxMessages {
+		return nil
+	}
+	cut := len(c.Messages) - c.MaxMessages/2
+	var transcript strings.Builder
+	for _, m := range c.Messages[:cut] {
+		fmt.Fprintf(&transcript, "%s: %s\n", m.Role, m.Content)
+	}
+
+	content, err := set.Render(prompts.Summarize, prompts.Data{
+		Summary:    c.Summary,
+		Transcript: transcript.String(),
+	})
+	if err != nil {
+		return err
+	}
+	summary, _, err := RefineRecommendationsWithMemory(ctx, client, model, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: content},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	c.Summary = strings.TrimSpace(summary)
+	c.Messages = append([]openai.ChatCompletionMessage(nil), c.Messages[cut:]...)
+	return nil
+}
+
+// Export converts the history into the form stored alongside saved plans.
+func (c *Conversation) Export() []models.ChatMessage {
+	if c == nil {
+		return nil
+	}
+	var out []models.ChatMessage
+	if c.Summary != "" {
+		out = append(out, models.ChatMessage{Role: openai.ChatMessageRoleSystem, Content: c.Summary})
+	}
+	for _, m := range c.Messages {
+		out = append(out, models.ChatMessage{Role: m.Role, Content: m.Content})
+	}
+	return out
+}
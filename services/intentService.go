@@ -2,49 +2,67 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 
+	"github.com/HenryArin/ReddmeitAlpha/controllers"
+	"github.com/HenryArin/ReddmeitAlpha/prompts"
 	openai "github.com/sashabaranov/go-openai"
 )
 
-type IntentType string
-
-const (
-	ShowSubs           IntentType = "show_subs"
-	RegenerateAdds     IntentType = "regenerate_adds"
-	RegenerateRemoves  IntentType = "regenerate_removes"
-	ClearRemoves       IntentType = "clear_removes"
-	NewPrompt          IntentType = "new_prompt"
-	RefineRemoves      IntentType = "refine_removes"
-	RemoveOnlyIntent   IntentType = "remove_only"
-	None               IntentType = "none"
-)
+// ClassifyIntent runs the rule-based parser first and only asks the LLM when
+// the rules are not confident. If the LLM is unavailable the rule-based
+// result is used as is.
+func ClassifyIntent(ctx context.Context, input string) controllers.Intent {
+	intent := controllers.ParseConversationIntent(input)
+	if intent.Confidence >= controllers.ConfidentIntent {
+		return intent
+	}
 
-func GetIntentFromGPT(input string) IntentType {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
-		panic("Missing OPENAI_API_KEY")
+		fmt.Println("⚠️  Intent classifier unavailable, using best guess: OPENAI_API_KEY unset")
+		return intent
 	}
+	return classifyWithGPT(ctx, openai.NewClient(apiKey), prompts.Default(), intent, os.Stdout)
+}
 
-	client := openai.NewClient(apiKey)
-
-	system := openai.ChatCompletionMessage{
-		Role: openai.ChatMessageRoleSystem,
-		Content: `
-You are an intent classifier for a Reddit assistant. Respond with ONE of the following keywords only:
+// classifyWithGPT relabels a low-confidence rule-based intent with the
+// model's answer, keeping the rule-based result (and its low confidence) if
+// the model fails or answers with a label it doesn't know. The intent
+// prompt comes from set, and a failure is noted on out.
+func classifyWithGPT(ctx context.Context, client *openai.Client, set *prompts.Set, intent controllers.Intent, out io.Writer) controllers.Intent {
+	t, err := intentFromGPT(ctx, client, set, intent.RawFeedback)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️  Intent classifier unavailable, using best guess: %v\n", err)
+		return intent
+	}
+	intent.ApplyType(t)
+	intent.Confidence = 0.8
+	intent.Source = "llm"
+	return intent
+}
 
-- "show_subs" → if they want to see current subreddit subscriptions
-- "regenerate_adds" → if they want more subreddit suggestions to add
-- "regenerate_removes" → if they want more subs to remove
-- "refine_removes" → if they want to remove some and keep others
-- "remove_only" → if they only want to prune or clean inactive subs
-- "clear_removes" → if they want to cancel/remove all previous removals
-- "new_prompt" → if it's a completely new topic
-- "none" → if it's just confirmation or mild feedback
+// GetIntentFromGPT asks the model to label input with one IntentType.
+// Unrecognized answers are reported as an error.
+func GetIntentFromGPT(ctx context.Context, input string) (controllers.IntentType, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return controllers.None, fmt.Errorf("OPENAI_API_KEY unset")
+	}
+	return intentFromGPT(ctx, openai.NewClient(apiKey), prompts.Default(), input)
+}
 
-Return one keyword only. No extra text.
-`,
+func intentFromGPT(ctx context.Context, client *openai.Client, set *prompts.Set, input string) (controllers.IntentType, error) {
+	content, err := set.Render(prompts.Intent, prompts.Data{})
+	if err != nil {
+		return controllers.None, err
+	}
+	system := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: content,
 	}
 
 	user := openai.ChatCompletionMessage{
@@ -53,23 +71,25 @@ Return one keyword only. No extra text.
 	}
 
 	resp, err := client.CreateChatCompletion(
-		context.Background(),
+		ctx,
 		openai.ChatCompletionRequest{
 			Model:    openai.GPT3Dot5Turbo,
 			Messages: []openai.ChatCompletionMessage{system, user},
 		},
 	)
 	if err != nil {
-		panic("Intent GPT error: " + err.Error())
+		return controllers.None, fmt.Errorf("intent GPT error: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return controllers.None, fmt.Errorf("intent GPT returned no choices")
 	}
 
-	result := strings.TrimSpace(resp.Choices[0].Message.Content)
-
-	switch IntentType(result) {
-	case ShowSubs, RegenerateAdds, RegenerateRemoves, ClearRemoves,
-		NewPrompt, RefineRemoves, RemoveOnlyIntent, None:
-		return IntentType(result)
-	default:
-		return None
+	result := strings.Trim(strings.TrimSpace(resp.Choices[0].Message.Content), `"'.`)
+	for _, t := range controllers.IntentTypes {
+		if string(t) == result {
+			return t, nil
+		}
 	}
+	// Reading an unknown label as None would silently drop the request.
+	return controllers.None, fmt.Errorf("intent GPT returned unknown label %q", result)
 }
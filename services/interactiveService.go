@@ -1,19 +1,25 @@
 package services
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strings"
 
-	"github.com/HenryArin/ReddmeitAlpha/controllers"
 	"github.com/HenryArin/ReddmeitAlpha/models"
 	"github.com/HenryArin/ReddmeitAlpha/utils"
 )
 
-// RunInteractiveSession handles the interactive user loop for AI subreddit planning
-func RunInteractiveSession() error {
-	utils.LoadEnv()
+// RunInteractiveSession handles the interactive user loop for AI subreddit
+// planning. The session is autosaved after every turn; with resume set it
+// continues from the last save.
+func RunInteractiveSession(resume bool) error {
+	if err := utils.LoadEnv(); err != nil {
+		return err
+	}
 	token := os.Getenv("REDDIT_ACCESS_TOKEN")
 	user := os.Getenv("REDDIT_USERNAME")
 	if token == "" || user == "" {
@@ -23,78 +29,156 @@ func RunInteractiveSession() error {
 	// 🆕 Onboarding message
 	fmt.Println("💡 Type what you're into, like 'I'm into hiking and photography'.")
 	fmt.Println("   You can also say things like 'get rid of news subs' or 'show my current plan'.")
-	fmt.Println("   Type 'summary' or 'review' anytime to preview the current recommendation.\n")
+	fmt.Println("   Type 'summary' or 'review' anytime to preview the current recommendation.")
+	fmt.Println("   Commands like /add r/books or /drop r/news edit the plan directly; /help lists them all.")
+	fmt.Println()
+
+	editor := utils.NewLineEditor(utils.HistoryFile())
+	st, err := newInteractiveState(token, user, func(question string) (string, error) {
+		// Ctrl-C or Ctrl-D come back as errors, which count as "no".
+		return editor.ReadLine(question + "\n> ")
+	})
+	if err != nil {
+		return err
+	}
+	editor.Complete = st.CompleteCommand
 
-	reader := bufio.NewReader(os.Stdin)
-	finalPlan := models.RecommendationPlan{}
+	if resume {
+		if err := st.resume(false); err != nil {
+			return fmt.Errorf("resume: %w", err)
+		}
+	} else if saved, ok := st.noteSavedSession(); ok {
+		fmt.Printf("💾 You have a session saved %s; type /resume to continue it.\n\n", saved.SavedAt.Local().Format("2006-01-02 15:04"))
+	}
 
 	for {
-		fmt.Print("🧠 What are you into? (or ask 'show subs')\n> ")
-		prompt, _ := reader.ReadString('\n')
-		prompt = strings.TrimSpace(prompt)
-		lowerPrompt := strings.ToLower(prompt)
+		// Saving before every prompt covers each way a turn can end.
+		st.autosave()
+
+		line, err := editor.ReadLine("🧠 What are you into? (or ask 'show subs', /help for commands)\n> ")
+		if errors.Is(err, utils.ErrInterrupted) {
+			// Ctrl-C discards the current line and starts a new turn.
+			continue
+		}
+		if err != nil {
+			// Ctrl-D or the end of piped input finishes the session.
+			break
+		}
+		prompt := strings.TrimSpace(line)
+		if prompt == "" {
+			continue
+		}
+		editor.AddHistory(prompt)
+
+		// Slash commands edit the plan directly, without the assistant.
+		if IsSlashCommand(prompt) {
+			if err := runSlashCommand(st, prompt); err != nil {
+				fmt.Printf("❌ %v\n", err)
+			}
+			continue
+		}
+
+		// Classify intent: rules first, the LLM only when they are unsure.
+		// Ctrl-C cancels this turn without ending the session.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		intent := st.ClassifyIntent(ctx, prompt)
 
 		// 🆕 Check for "show", "review", or "summary"
-		if lowerPrompt == "show" || lowerPrompt == "review" || lowerPrompt == "summary" {
+		if intent.ShowPlan {
+			stop()
 			fmt.Println("\n📋 Current plan so far:")
-			utils.PrintPlan(finalPlan)
-			fmt.Print("Would you like to add or remove anything else? (yes/no)\n> ")
-			resp, _ := reader.ReadString('\n')
-			resp = strings.ToLower(strings.TrimSpace(resp))
-			if resp != "yes" {
+			utils.PrintPlan(st.Plan)
+			if !st.keepGoing() {
 				break
 			}
 			continue
 		}
 
-		// Parse intent
-		intent := controllers.ParseConversationIntent(prompt)
+		if intent.ClearRemoves {
+			stop()
+			st.snapshot()
+			st.Plan.ToRemove = nil
+			fmt.Println("🛑 Cleared all removals from the plan.")
+			continue
+		}
 
 		// Fetch current user activity
-		subscribed := FetchSubscribedSubreddits(token)
-		upvoted := FetchUserActivity(user, token, "upvoted")
-		commented := FetchUserActivity(user, token, "comments")
-
-		// Get AI recommendation with intent
-		result, err := HandleRequest(prompt, intent, subscribed, upvoted, commented)
+		st.refreshActivity()
+
+		// Get AI recommendation with intent, streaming the reply as it
+		// arrives.
+		out := &headerWriter{w: os.Stdout, header: "🤖 AI recommendations:\n"}
+		result, err := st.HandleRequest(ctx, prompt, intent, st.subscribed, st.upvoted, st.commented, out)
+		stop()
+		if out.started {
+			fmt.Println()
+		}
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("⏹️  Request cancelled.")
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("assistant error: %w", err)
 		}
+		if result.Cached {
+			fmt.Println("♻️  Reused a cached reply for this request.")
+		}
 
+		st.snapshot()
 		if result.ViewOnly {
 			fmt.Println(result.Reply)
 		} else if len(result.Plan.ToAdd) == 0 && len(result.Plan.ToRemove) == 0 {
 			fmt.Println("🤖 No strong subreddit matches. Try rephrasing or being more specific?")
 		} else {
-			fmt.Println("🤖 AI recommendations:")
+			fmt.Println("📋 Suggested changes:")
 			utils.PrintPlan(result.Plan)
-			finalPlan = utils.MergePlans(finalPlan, result.Plan)
+			st.mergeSuggestion(result.Plan)
 		}
+		// "skip r/x" or "don't remove r/y" also applies to earlier turns.
+		st.Plan = ApplyFeedback(intent, st.Plan)
+		st.learnFromFeedback(intent)
 
-		fmt.Print("Would you like to add or remove anything else? (yes/no)\n> ")
-		resp, _ := reader.ReadString('\n')
-		resp = strings.ToLower(strings.TrimSpace(resp))
-		if resp != "yes" {
+		if !st.keepGoing() {
 			break
 		}
 	}
 
-	// Final confirmation
+	st.autosave()
+
+	// Final confirmation, either for the whole plan or item by item
+	finalPlan := st.Plan
 	fmt.Println("\n✅ Final Recommendation:")
 	utils.PrintPlan(finalPlan)
 
-	fmt.Print("⚠️  Apply these changes? (yes/no)\n> ")
-	confirm, _ := reader.ReadString('\n')
-	confirm = strings.ToLower(strings.TrimSpace(confirm))
-
-	if confirm != "yes" {
+	answer, _ := st.ask("⚠️  Apply these changes? (yes/no/review)")
+	approved := false
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "yes":
+		approved = true
+		st.Plan = models.RecommendationPlan{}
+	case "review":
+		finalPlan, approved = st.review()
+	}
+	if !approved {
 		fmt.Println("❌ Changes canceled.")
+		st.autosave()
+		if !st.Empty() {
+			fmt.Println("💾 Your session is saved; run with --resume to pick it up again.")
+		}
 		return nil
 	}
 
 	// Save and apply
-	utils.SavePlanToFile(finalPlan, "interactive_session")
-	ApplyPlan(finalPlan, token)
+	st.savePlan(finalPlan, "interactive_session")
+	ApplyPlan(finalPlan, token, st.Protected, os.Stdout)
+	st.learnAccepted()
+	if len(st.Plan.ToAdd) > 0 || len(st.Plan.ToRemove) > 0 {
+		// Deferred changes are kept for another session.
+		st.autosave()
+		fmt.Println("💾 Deferred changes are saved; run with --resume to revisit them.")
+	} else if err := utils.ClearSessionState(); err != nil {
+		fmt.Printf("⚠️  Failed to clear saved session: %v\n", err)
+	}
 
 	// Summary
 	if len(finalPlan.ToAdd) > 0 {
@@ -110,3 +194,55 @@ func RunInteractiveSession() error {
 	fmt.Println("\n🎉 All done!")
 	return nil
 }
+
+// keepGoing asks whether the user wants another turn. Ctrl-C at the
+// question cancels it like any other turn, so only "no" or the end of input
+// moves on to applying the plan.
+func (st *interactiveState) keepGoing() bool {
+	yes, err := st.askYesNo("Would you like to add or remove anything else? (yes/no)")
+	if errors.Is(err, utils.ErrInterrupted) {
+		return true
+	}
+	return yes
+}
+
+// newInteractiveState sets up a session for token and user with the saved
+// preferences and protected list, asking questions through ask. A protected
+// list that can't be read is an error: carrying on without it could
+// unsubscribe from the subreddits it protects.
+func newInteractiveState(token, user string, ask func(question string) (string, error)) (*interactiveState, error) {
+	protected, err := utils.LoadProtected()
+	if err != nil {
+		return nil, fmt.Errorf("loading protected subreddits: %w", err)
+	}
+
+	prefs, err := utils.LoadPreferences()
+	if err != nil {
+		fmt.Printf("⚠️  Failed to load preferences: %v\n", err)
+	}
+
+	session := NewSession()
+	session.Protected = protected
+	session.Prefs = prefs
+	session.RedditToken = token
+	session.Account = user
+	return &interactiveState{Session: session, token: token, user: user, ask: ask}, nil
+}
+
+// headerWriter prints header before the first write so streamed replies are
+// introduced only when there is something to show.
+type headerWriter struct {
+	w       io.Writer
+	header  string
+	started bool
+}
+
+func (h *headerWriter) Write(p []byte) (int, error) {
+	if !h.started && len(p) > 0 {
+		h.started = true
+		if _, err := io.WriteString(h.w, h.header); err != nil {
+			return 0, err
+		}
+	}
+	return h.w.Write(p)
+}
@@ -5,8 +5,51 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
 )
 
+// FetchSubscriptions returns the user's subscriptions like
+// FetchSubscribedSubreddits, but fails when Reddit does: an expired token
+// or rate limit must not look like an empty subscription list to code that
+// decides what has already happened, such as the stale-change check.
+func FetchSubscriptions(accessToken string) (map[string]bool, error) {
+	subreddits := make(map[string]bool)
+	after := ""
+	for {
+		endpoint := "https://oauth.reddit.com/subreddits/mine/subscriber?limit=100"
+		if after != "" {
+			endpoint += "&after=" + url.QueryEscape(after)
+		}
+		var parsed struct {
+			Data *struct {
+				Children []struct {
+					Data struct {
+						DisplayName string `json:"display_name"`
+					} `json:"data"`
+				} `json:"children"`
+				After string `json:"after"`
+			} `json:"data"`
+		}
+		if err := redditGet(endpoint, accessToken, &parsed); err != nil {
+			return nil, fmt.Errorf("fetching subscriptions: %w", err)
+		}
+		if parsed.Data == nil {
+			return nil, fmt.Errorf("fetching subscriptions: %w", redditError{"unexpected response from Reddit"})
+		}
+		for _, child := range parsed.Data.Children {
+			subreddits[child.Data.DisplayName] = true
+		}
+		if parsed.Data.After == "" || parsed.Data.After == "null" {
+			return subreddits, nil
+		}
+		after = parsed.Data.After
+	}
+}
+
 func FetchSubscribedSubreddits(accessToken string) map[string]bool {
 	client := &http.Client{}
 	after := ""
@@ -80,35 +123,35 @@ func FetchUserActivity(username, accessToken, activityType string) map[string]bo
 		resp.Body.Close() // Close immediately after reading
 
 		if resp.StatusCode != 200 {
-			fmt.Printf("Reddit API error (%s): %d\n", activityType, resp.StatusCode)
-			fmt.Println("Response body:", string(body))
+			fmt.Fprintf(os.Stderr, "Reddit API error (%s): %d\n", activityType, resp.StatusCode)
+			fmt.Fprintln(os.Stderr, "Response body:", string(body))
 			break
 		}
 
 		var parsed map[string]interface{}
 		if err := json.Unmarshal(body, &parsed); err != nil {
-			fmt.Println("Failed to parse JSON:", err)
-			fmt.Println("Raw response:", string(body))
+			fmt.Fprintln(os.Stderr, "Failed to parse JSON:", err)
+			fmt.Fprintln(os.Stderr, "Raw response:", string(body))
 			break
 		}
 
 		rawData, ok := parsed["data"]
 		if !ok {
-			fmt.Println("Missing 'data' in Reddit response")
-			fmt.Println("Raw response:", string(body))
+			fmt.Fprintln(os.Stderr, "Missing 'data' in Reddit response")
+			fmt.Fprintln(os.Stderr, "Raw response:", string(body))
 			break
 		}
 
 		data, ok := rawData.(map[string]interface{})
 		if !ok {
-			fmt.Printf("'data' is not a map[string]interface{} (got %T)\n", rawData)
-			fmt.Println("Raw response:", string(body))
+			fmt.Fprintf(os.Stderr, "'data' is not a map[string]interface{} (got %T)\n", rawData)
+			fmt.Fprintln(os.Stderr, "Raw response:", string(body))
 			break
 		}
 
 		children, ok := data["children"].([]interface{})
 		if !ok {
-			fmt.Println("Missing or invalid 'children' array in data")
+			fmt.Fprintln(os.Stderr, "Missing or invalid 'children' array in data")
 			break
 		}
 
@@ -173,3 +216,132 @@ func FetchSubredditDescription(subreddit, accessToken string) string {
 	json.Unmarshal(body, &result)
 	return result.Data.PublicDescription
 }
+
+// SearchSubreddits returns communities matching query, most relevant first.
+func SearchSubreddits(query, accessToken string, limit int) ([]models.SubredditInfo, error) {
+	endpoint := fmt.Sprintf("https://oauth.reddit.com/subreddits/search?q=%s&limit=%d", url.QueryEscape(query), limit)
+	var parsed struct {
+		Data struct {
+			Children []struct {
+				Data subredditAbout `json:"data"`
+			} `json:"children"`
+		} `json:"data"`
+	}
+	if err := redditGet(endpoint, accessToken, &parsed); err != nil {
+		return nil, err
+	}
+	var out []models.SubredditInfo
+	for _, child := range parsed.Data.Children {
+		out = append(out, child.Data.info())
+	}
+	return out, nil
+}
+
+// FetchSubredditAbout returns a community's metadata. It fails for
+// subreddits that don't exist or can't be viewed.
+func FetchSubredditAbout(subreddit, accessToken string) (models.SubredditInfo, error) {
+	name := strings.TrimPrefix(subreddit, "r/")
+	var parsed struct {
+		Kind string         `json:"kind"`
+		Data subredditAbout `json:"data"`
+	}
+	if err := redditGet("https://oauth.reddit.com/r/"+url.PathEscape(name)+"/about", accessToken, &parsed); err != nil {
+		return models.SubredditInfo{}, err
+	}
+	// Reddit answers unknown names with a search listing instead of a 404.
+	if parsed.Kind != "t5" || parsed.Data.DisplayName == "" {
+		return models.SubredditInfo{}, fmt.Errorf("r/%s not found", name)
+	}
+	return parsed.Data.info(), nil
+}
+
+// FetchSubredditRules returns the short names of a community's rules.
+func FetchSubredditRules(subreddit, accessToken string) ([]string, error) {
+	name := strings.TrimPrefix(subreddit, "r/")
+	var parsed struct {
+		Rules []struct {
+			ShortName string `json:"short_name"`
+		} `json:"rules"`
+	}
+	if err := redditGet("https://oauth.reddit.com/r/"+url.PathEscape(name)+"/about/rules", accessToken, &parsed); err != nil {
+		return nil, err
+	}
+	var rules []string
+	for _, rule := range parsed.Rules {
+		rules = append(rules, rule.ShortName)
+	}
+	return rules, nil
+}
+
+// FetchTopPosts returns the top posts of a community for timeframe
+// ("day", "week", "month", "year" or "all").
+func FetchTopPosts(subreddit, accessToken, timeframe string, limit int) ([]models.PostSummary, error) {
+	name := strings.TrimPrefix(subreddit, "r/")
+	endpoint := fmt.Sprintf("https://oauth.reddit.com/r/%s/top?t=%s&limit=%d", url.PathEscape(name), url.QueryEscape(timeframe), limit)
+	var parsed struct {
+		Data struct {
+			Children []struct {
+				Data models.PostSummary `json:"data"`
+			} `json:"children"`
+		} `json:"data"`
+	}
+	if err := redditGet(endpoint, accessToken, &parsed); err != nil {
+		return nil, err
+	}
+	var posts []models.PostSummary
+	for _, child := range parsed.Data.Children {
+		posts = append(posts, child.Data)
+	}
+	return posts, nil
+}
+
+type subredditAbout struct {
+	DisplayName       string `json:"display_name"`
+	Title             string `json:"title"`
+	PublicDescription string `json:"public_description"`
+	Subscribers       int    `json:"subscribers"`
+	Over18            bool   `json:"over18"`
+}
+
+func (a subredditAbout) info() models.SubredditInfo {
+	return models.SubredditInfo{
+		Name:        a.DisplayName,
+		Title:       a.Title,
+		Description: a.PublicDescription,
+		Subscribers: a.Subscribers,
+		Over18:      a.Over18,
+	}
+}
+
+// redditError is returned when Reddit can't be reached or rejects a
+// request, for example because the access token expired.
+type redditError struct{ msg string }
+
+func (e redditError) Error() string { return e.msg }
+
+// redditGet performs an authenticated GET and decodes the JSON body into out.
+// Failures to reach Reddit and non-200 responses are redditErrors.
+func redditGet(endpoint, accessToken string, out any) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+accessToken)
+	req.Header.Set("User-Agent", "reddmeitalpha/0.1")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return redditError{err.Error()}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return redditError{err.Error()}
+	}
+	if resp.StatusCode != 200 {
+		return redditError{fmt.Sprintf("reddit API returned %d for %s", resp.StatusCode, endpoint)}
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+)
+
+// planReport builds the report for plan. Formats meant for sharing
+// (everything but the terminal ones) get member counts looked up on Reddit
+// when a token is available.
+func planReport(plan models.RecommendationPlan, meta models.PlanDocument, format, token string) utils.PlanReport {
+	report := utils.PlanReport{Plan: plan, Meta: meta}
+	if token != "" && format != utils.FormatTerminal && format != utils.FormatText {
+		report.Members = memberCounts(plan, token)
+	}
+	return report
+}
+
+// memberCounts looks up how many members each subreddit in plan has,
+// skipping the ones Reddit can't find.
+func memberCounts(plan models.RecommendationPlan, token string) map[string]int {
+	subs := append(append([]string(nil), plan.ToAdd...), plan.ToRemove...)
+	if len(subs) == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "🔎 Looking up %d subreddit(s)...\n", len(subs))
+	counts := map[string]int{}
+	for _, sub := range subs {
+		if info, err := FetchSubredditAbout(sub, token); err == nil {
+			counts[sub] = info.Subscribers
+		}
+	}
+	return counts
+}
+
+// writeReport renders report to filename, or to w if filename is "".
+func writeReport(w io.Writer, filename, format string, report utils.PlanReport) error {
+	if filename == "" {
+		return utils.RenderPlan(w, format, report)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := utils.RenderPlan(f, format, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+)
+
+const uncategorized = "Other"
+
+type decision int
+
+const (
+	pending decision = iota
+	accepted
+	rejected
+	deferred
+)
+
+// reviewItem is one change offered for approval.
+type reviewItem struct {
+	sub      string
+	remove   bool
+	category string
+	decision decision
+}
+
+// reviewPlan walks through every change in plan, grouped by category, and
+// asks whether to accept, reject or defer it. It returns the accepted
+// changes and the deferred ones; anything left undecided is deferred.
+func (st *interactiveState) reviewPlan(plan models.RecommendationPlan) (approved, later models.RecommendationPlan) {
+	items := reviewItems(plan)
+	fmt.Println("🔎 Reviewing each change: [y]es, [n]o, [d]efer, [c] accept the rest of the category, [a] accept all, [q] defer the rest.")
+
+	category := ""
+review:
+	for i := 0; i < len(items); i++ {
+		it := &items[i]
+		if it.decision != pending {
+			continue
+		}
+		if it.category != category {
+			category = it.category
+			fmt.Printf("\n%s:\n", category)
+		}
+		st.describe(plan, *it, i+1, len(items))
+
+		answer, err := st.ask("Accept? (y/n/d/c/a/q)")
+		if err != nil {
+			answer = "q"
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			it.decision = accepted
+		case "n", "no":
+			it.decision = rejected
+		case "d", "defer":
+			it.decision = deferred
+		case "c":
+			for j := i; j < len(items); j++ {
+				if items[j].decision == pending && items[j].category == category {
+					items[j].decision = accepted
+				}
+			}
+			fmt.Printf("✅ Accepted the rest of %s.\n", category)
+		case "a":
+			for j := i; j < len(items); j++ {
+				if items[j].decision == pending {
+					items[j].decision = accepted
+				}
+			}
+			fmt.Println("✅ Accepted everything left.")
+			break review
+		case "q":
+			break review
+		default:
+			fmt.Println("Answer y, n, d, c, a or q.")
+			i--
+		}
+	}
+
+	var rejectedAdds []string
+	approved = subsetPlan(plan, items, accepted)
+	later = subsetPlan(plan, items, pending, deferred)
+	for _, it := range items {
+		if it.decision == rejected && !it.remove {
+			rejectedAdds = append(rejectedAdds, it.sub)
+		}
+	}
+	// Rejected suggestions shouldn't come back when asking for more.
+	st.rememberShown(rejectedAdds)
+	return approved, later
+}
+
+// review runs reviewPlan on the session plan and asks to apply what was
+// approved. Deferred changes stay in the session plan; rejected ones are
+// dropped. It reports false if there is nothing to apply or the user says
+// no, in which case the approved changes go back into the plan.
+func (st *interactiveState) review() (models.RecommendationPlan, bool) {
+	st.snapshot()
+	approved, later := st.reviewPlan(st.Plan)
+	st.Plan = later
+	if len(approved.ToAdd) == 0 && len(approved.ToRemove) == 0 {
+		fmt.Println("\n= Nothing approved.")
+		return approved, false
+	}
+	fmt.Println("\n✅ Approved changes:")
+	utils.PrintPlan(approved)
+	if len(later.ToAdd) > 0 || len(later.ToRemove) > 0 {
+		fmt.Printf("⏳ %d change(s) deferred.\n", len(later.ToAdd)+len(later.ToRemove))
+	}
+	if !st.confirm("⚠️  Apply the approved changes? (yes/no)") {
+		st.Plan, _ = utils.MergePlans(later, approved, utils.MergeOptions{Protected: st.Protected})
+		return approved, false
+	}
+	return approved, true
+}
+
+// describe prints one change with its explanation and what is known about
+// the subreddit.
+func (st *interactiveState) describe(plan models.RecommendationPlan, it reviewItem, n, total int) {
+	sign := "+"
+	if it.remove {
+		sign = "-"
+	}
+	fmt.Printf("[%d/%d] %s %s", n, total, sign, it.sub)
+	if explanation := plan.Explanations[it.sub]; explanation != "" {
+		fmt.Printf(" – %s", explanation)
+	}
+	fmt.Println()
+
+	var details []string
+	if it.remove {
+		name := strings.TrimPrefix(it.sub, "r/")
+		switch {
+		case st.commented[name]:
+			details = append(details, "you commented there recently")
+		case st.upvoted[name]:
+			details = append(details, "you upvoted there recently")
+		case st.upvoted != nil:
+			details = append(details, "no recent activity")
+		}
+	} else if info, err := FetchSubredditAbout(it.sub, st.token); err == nil {
+		details = append(details, utils.FormatMembers(info.Subscribers)+" members")
+		if info.Over18 {
+			details = append(details, "🔞 NSFW")
+		}
+		if info.Title != "" {
+			details = append(details, fmt.Sprintf("%q", info.Title))
+		}
+	}
+	if st.Protected.Contains(it.sub) {
+		details = append(details, "🛡️ protected")
+	}
+	if len(details) > 0 {
+		fmt.Printf("      %s\n", strings.Join(details, " · "))
+	}
+}
+
+// reviewItems lists a plan's changes grouped by category, uncategorized
+// ones last, with additions before removals.
+func reviewItems(plan models.RecommendationPlan) []reviewItem {
+	var items []reviewItem
+	for _, sub := range plan.ToAdd {
+		items = append(items, reviewItem{sub: sub, category: categoryOf(plan, sub)})
+	}
+	for _, sub := range plan.ToRemove {
+		items = append(items, reviewItem{sub: sub, remove: true, category: categoryOf(plan, sub)})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.category != b.category {
+			if a.category == uncategorized || b.category == uncategorized {
+				return b.category == uncategorized
+			}
+			return a.category < b.category
+		}
+		if a.remove != b.remove {
+			return !a.remove
+		}
+		return strings.ToLower(a.sub) < strings.ToLower(b.sub)
+	})
+	return items
+}
+
+func categoryOf(plan models.RecommendationPlan, sub string) string {
+	if category := plan.Categories[sub]; category != "" {
+		return category
+	}
+	return uncategorized
+}
+
+// subsetPlan returns the part of plan whose items have one of the given
+// decisions, keeping their explanations and categories.
+func subsetPlan(plan models.RecommendationPlan, items []reviewItem, decisions ...decision) models.RecommendationPlan {
+	out := models.RecommendationPlan{
+		Explanations:  map[string]string{},
+		Categories:    map[string]string{},
+		PromptVersion: plan.PromptVersion,
+	}
+	for _, it := range items {
+		match := false
+		for _, d := range decisions {
+			match = match || it.decision == d
+		}
+		if !match {
+			continue
+		}
+		if it.remove {
+			out.ToRemove = append(out.ToRemove, it.sub)
+		} else {
+			out.ToAdd = append(out.ToAdd, it.sub)
+		}
+		if explanation, ok := plan.Explanations[it.sub]; ok {
+			out.Explanations[it.sub] = explanation
+		}
+		if category, ok := plan.Categories[it.sub]; ok {
+			out.Categories[it.sub] = category
+		}
+	}
+	return out
+}
@@ -0,0 +1,639 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/controllers"
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+	"github.com/HenryArin/ReddmeitAlpha/web"
+)
+
+// DefaultServerAddr is where `reddmeit serve` listens unless --addr or
+// REDDMEIT_SERVER_ADDR says otherwise. It only accepts local connections.
+const DefaultServerAddr = "127.0.0.1:8787"
+
+// maxRequestBody caps JSON and plan text sent to the server.
+const maxRequestBody = 1 << 20
+
+// Sessions idle for longer than sessionIdleTimeout are dropped, and at most
+// maxSessions are kept; the least recently used one makes room for a new
+// one.
+const (
+	sessionIdleTimeout = 12 * time.Hour
+	maxSessions        = 100
+)
+
+// Server exposes the recommendation engine as a JSON API for local tools
+// such as dashboards. Every client gets its own Session, named by the
+// X-Reddmeit-Session header (or ?session=), so several users' plans and
+// conversations don't mix. Sessions live in memory until the server stops
+// or they expire.
+type Server struct {
+	RedditToken string
+	Account     string
+
+	// APIKey, when set, must be sent as "Authorization: Bearer <key>".
+	// NewServer makes a random one when REDDMEIT_API_KEY is unset.
+	APIKey       string
+	generatedKey bool
+
+	// listenHost is the host ListenAndServe listens on. Requests must name
+	// it or a loopback host, which keeps DNS rebinding attacks out.
+	listenHost string
+
+	// applyMu lets one apply run at a time across all sessions, from the
+	// stale check to the last change.
+	applyMu sync.Mutex
+
+	mu       sync.Mutex
+	sessions map[string]*serverSession
+}
+
+// serverSession serializes requests to one Session, which isn't safe for
+// concurrent use.
+type serverSession struct {
+	mu       sync.Mutex
+	lastUsed time.Time // guarded by Server.mu
+	*Session
+}
+
+// NewServer returns a server configured from the environment.
+func NewServer() *Server {
+	srv := &Server{
+		RedditToken: os.Getenv("REDDIT_ACCESS_TOKEN"),
+		Account:     os.Getenv("REDDIT_USERNAME"),
+		APIKey:      os.Getenv("REDDMEIT_API_KEY"),
+		sessions:    map[string]*serverSession{},
+	}
+	if srv.APIKey == "" {
+		srv.APIKey = rand.Text()
+		srv.generatedKey = true
+	}
+	return srv
+}
+
+// ServerAddr returns the address from REDDMEIT_SERVER_ADDR, or
+// DefaultServerAddr.
+func ServerAddr() string {
+	if addr := os.Getenv("REDDMEIT_SERVER_ADDR"); addr != "" {
+		return addr
+	}
+	return DefaultServerAddr
+}
+
+// Handler returns the API's routes and the dashboard, served at /.
+func (srv *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /", web.Handler())
+	mux.HandleFunc("GET /api/subs", srv.handleSubs)
+	mux.HandleFunc("GET /api/activity", srv.handleActivity)
+	mux.HandleFunc("GET /api/subreddits/{name}", srv.handleSubreddit)
+	mux.HandleFunc("POST /api/recommend", srv.withSession(srv.handleRecommend))
+	mux.HandleFunc("GET /api/plan", srv.withSession(srv.handleGetPlan))
+	mux.HandleFunc("PUT /api/plan", srv.withSession(srv.handlePutPlan))
+	mux.HandleFunc("DELETE /api/plan", srv.withSession(srv.handleDeletePlan))
+	mux.HandleFunc("POST /api/plan/merge", srv.withSession(srv.handleMergePlan))
+	mux.HandleFunc("POST /api/apply", srv.withSession(srv.handleApply))
+	mux.HandleFunc("GET /api/history", srv.handleHistory)
+	mux.HandleFunc("GET /api/plans", srv.handleListPlans)
+	mux.HandleFunc("GET /api/plans/{name}", srv.handleGetSavedPlan)
+	return srv.guard(mux)
+}
+
+// ListenAndServe serves the API on addr until ctx is cancelled.
+func (srv *Server) ListenAndServe(ctx context.Context, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	srv.listenHost = host
+	if !isLoopbackHost(host) {
+		fmt.Fprintf(os.Stderr, "⚠️  %s is not a loopback address: other machines can reach the server, and anyone with the API key can change your subscriptions.\n", addr)
+	}
+	hs := &http.Server{
+		Addr:              addr,
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- hs.ListenAndServe() }()
+	if srv.generatedKey {
+		// The fragment never reaches the server; the dashboard reads the
+		// key from it and remembers it.
+		fmt.Fprintf(os.Stderr, "🌐 Dashboard on http://%s/#key=%s (API under /api/)\n", addr, srv.APIKey)
+		fmt.Fprintf(os.Stderr, "🔑 API key for this run: %s (set REDDMEIT_API_KEY to choose your own)\n", srv.APIKey)
+	} else {
+		fmt.Fprintf(os.Stderr, "🌐 Dashboard on http://%s/ (API under /api/)\n", addr)
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return hs.Shutdown(shutdown)
+	}
+}
+
+// guard refuses requests for other hosts or from other origins, checks
+// the API key and content type on /api/ requests, and turns a panic from
+// the Reddit helpers into a 502 response.
+func (srv *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("%s %s: %v", r.Method, r.URL.Path, rec)
+				writeError(w, http.StatusBadGateway, fmt.Errorf("%v", rec))
+			}
+		}()
+		if !srv.allowedHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("requests for host %q are not accepted", r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(origin, r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("cross-origin requests from %q are not accepted", origin))
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		want := []byte("Bearer " + srv.APIKey)
+		if srv.APIKey != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong API key"))
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// Browsers only send JSON cross-site after a CORS preflight,
+			// which this server never approves.
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, errors.New("Content-Type must be application/json"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether a request's Host header names this server:
+// a loopback host, or the host it was told to listen on.
+func (srv *Server) allowedHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	if isLoopbackHost(host) {
+		return true
+	}
+	if ip := net.ParseIP(srv.listenHost); srv.listenHost == "" || (ip != nil && ip.IsUnspecified()) {
+		return false
+	}
+	return strings.EqualFold(host, srv.listenHost)
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// sameOrigin reports whether an Origin header names the page's own origin.
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return strings.EqualFold(u.Host, host)
+}
+
+// withSession runs handler with the caller's session locked.
+func (srv *Server) withSession(handler func(w http.ResponseWriter, r *http.Request, s *Session)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Reddmeit-Session")
+		if id == "" {
+			id = r.URL.Query().Get("session")
+		}
+		if id == "" {
+			id = "default"
+		}
+		ss, err := srv.session(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
+		handler(w, r, ss.Session)
+	}
+}
+
+// session returns the session named id, creating it on first use. Idle
+// sessions are dropped first, and the least recently used one when the
+// server already holds maxSessions.
+func (srv *Server) session(id string) (*serverSession, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	now := time.Now()
+	oldest := ""
+	for name, ss := range srv.sessions {
+		if now.Sub(ss.lastUsed) > sessionIdleTimeout {
+			delete(srv.sessions, name)
+		} else if oldest == "" || ss.lastUsed.Before(srv.sessions[oldest].lastUsed) {
+			oldest = name
+		}
+	}
+	if ss, ok := srv.sessions[id]; ok {
+		ss.lastUsed = now
+		return ss, nil
+	}
+	if len(srv.sessions) >= maxSessions {
+		delete(srv.sessions, oldest)
+	}
+	s := NewSession()
+	s.RedditToken = srv.RedditToken
+	s.Account = srv.Account
+	var err error
+	if s.Protected, err = utils.LoadProtected(); err != nil {
+		return nil, err
+	}
+	if s.Prefs, err = utils.LoadPreferences(); err != nil {
+		return nil, err
+	}
+	ss := &serverSession{Session: s, lastUsed: now}
+	srv.sessions[id] = ss
+	return ss, nil
+}
+
+func (srv *Server) handleSubs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, prefixedNames(FetchSubscribedSubreddits(srv.RedditToken)))
+}
+
+func (srv *Server) handleActivity(w http.ResponseWriter, r *http.Request) {
+	if srv.Account == "" {
+		writeError(w, http.StatusBadRequest, errors.New("REDDIT_USERNAME is not set"))
+		return
+	}
+	subscribed := FetchSubscribedSubreddits(srv.RedditToken)
+	upvoted := FetchUpvotedSubreddits(srv.Account, srv.RedditToken)
+	commented := FetchCommentedSubreddits(srv.Account, srv.RedditToken)
+	stats := []models.SubredditStats{}
+	for _, s := range controllers.CombineSubredditStats(subscribed, upvoted, commented) {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return strings.ToLower(stats[i].Name) < strings.ToLower(stats[j].Name) })
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (srv *Server) handleSubreddit(w http.ResponseWriter, r *http.Request) {
+	sub, err := utils.NormalizeSubreddit(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	info, err := FetchSubredditAbout(sub, srv.RedditToken)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// recommendResponse is what POST /api/recommend returns: the assistant's
+// answer and the session plan after merging it in.
+type recommendResponse struct {
+	Reply      string                    `json:"reply,omitempty"`
+	ViewOnly   bool                      `json:"view_only,omitempty"`
+	Cached     bool                      `json:"cached,omitempty"`
+	Suggestion models.RecommendationPlan `json:"suggestion"`
+	Conflicts  []utils.MergeConflict     `json:"conflicts,omitempty"`
+	Plan       models.PlanDocument       `json:"plan"`
+}
+
+func (srv *Server) handleRecommend(w http.ResponseWriter, r *http.Request, s *Session) {
+	var req struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	prompt := strings.TrimSpace(req.Prompt)
+	if prompt == "" {
+		writeError(w, http.StatusBadRequest, errors.New("prompt is required"))
+		return
+	}
+
+	ctx := r.Context()
+	intent := s.ClassifyIntent(ctx, prompt)
+	subscribed := FetchSubscribedSubreddits(srv.RedditToken)
+	var upvoted, commented map[string]bool
+	if srv.Account != "" {
+		upvoted = FetchUpvotedSubreddits(srv.Account, srv.RedditToken)
+		commented = FetchCommentedSubreddits(srv.Account, srv.RedditToken)
+	}
+	result, err := s.HandleRequest(ctx, prompt, intent, subscribed, upvoted, commented, nil)
+	if errors.Is(err, context.Canceled) {
+		return // the client went away
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	resp := recommendResponse{Reply: result.Reply, ViewOnly: result.ViewOnly, Cached: result.Cached, Suggestion: result.Plan}
+	if !result.ViewOnly {
+		// Nobody can be asked over HTTP, so "ask" resolves like "latest";
+		// the conflicts are returned for the client to show.
+		s.Plan, resp.Conflicts = utils.MergePlans(s.Plan, result.Plan, utils.MergeOptions{
+			Policy:    s.MergePolicy,
+			Protected: s.Protected,
+		})
+	}
+	s.Plan = ApplyFeedback(intent, s.Plan)
+	resp.Plan = s.PlanDocument(s.Plan)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (srv *Server) handleGetPlan(w http.ResponseWriter, r *http.Request, s *Session) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		srv.renderPlan(w, s, format)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.PlanDocument(s.Plan))
+}
+
+// renderPlan writes the session plan in a utils.Format, for ?format=.
+func (srv *Server) renderPlan(w http.ResponseWriter, s *Session, format string) {
+	format, err := utils.ParseFormat(format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	contentTypes := map[string]string{
+		utils.FormatMarkdown: "text/markdown; charset=utf-8",
+		utils.FormatHTML:     "text/html; charset=utf-8",
+		utils.FormatCSV:      "text/csv; charset=utf-8",
+		utils.FormatJSON:     "application/json",
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	utils.RenderPlan(w, format, planReport(s.Plan, s.PlanDocument(s.Plan), format, srv.RedditToken))
+}
+
+// handlePutPlan replaces the session plan. The body is a plan as JSON (a
+// saved plan document or a bare plan) or {"text": "..."} holding the text
+// format used by /edit.
+func (srv *Server) handlePutPlan(w http.ResponseWriter, r *http.Request, s *Session) {
+	var plan models.RecommendationPlan
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	var edited struct {
+		Text *string `json:"text"`
+	}
+	if err == nil && json.Unmarshal(data, &edited) == nil && edited.Text != nil {
+		plan, err = utils.ParsePlanText(*edited.Text, s.Plan)
+	} else if err == nil {
+		plan, err = parsePlanJSON(data)
+	}
+	if err == nil {
+		plan, err = utils.ValidatePlan(plan)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan.ToRemove = s.Protected.FilterRemovals(plan.ToRemove)
+	s.Plan = plan
+	writeJSON(w, http.StatusOK, s.PlanDocument(s.Plan))
+}
+
+func (srv *Server) handleDeletePlan(w http.ResponseWriter, r *http.Request, s *Session) {
+	s.Plan = models.RecommendationPlan{}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMergePlan merges a plan into the session plan. The policy defaults
+// to the session's; "ask" can't be answered over HTTP and is refused.
+func (srv *Server) handleMergePlan(w http.ResponseWriter, r *http.Request, s *Session) {
+	var req struct {
+		Plan   json.RawMessage `json:"plan"`
+		Policy string          `json:"policy"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan, err := parsePlanJSON(req.Plan)
+	if err == nil {
+		plan, err = utils.ValidatePlan(plan)
+	}
+	policy := s.MergePolicy
+	if err == nil && req.Policy != "" {
+		policy, err = utils.ParseMergePolicy(req.Policy)
+	}
+	if err == nil && policy == utils.MergeAsk && req.Policy != "" {
+		err = errors.New(`the "ask" policy needs a person; use latest or drop`)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var conflicts []utils.MergeConflict
+	s.Plan, conflicts = utils.MergePlans(s.Plan, plan, utils.MergeOptions{Policy: policy, Protected: s.Protected})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"plan":      s.PlanDocument(s.Plan),
+		"conflicts": conflicts,
+	})
+}
+
+// handleApply applies a plan, or with "dry_run" shows what would change.
+// Without a "plan" in the body the session plan is used, and cleared once
+// applied. Changes that already happened are skipped either way. Clients
+// that accept application/x-ndjson get each result as its own line as soon
+// as it is done, followed by a summary line.
+func (srv *Server) handleApply(w http.ResponseWriter, r *http.Request, s *Session) {
+	var req struct {
+		Plan   json.RawMessage `json:"plan"`
+		DryRun bool            `json:"dry_run"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan := s.Plan
+	fromSession := len(req.Plan) == 0 || string(req.Plan) == "null"
+	if !fromSession {
+		var err error
+		if plan, err = parsePlanJSON(req.Plan); err == nil {
+			plan, err = utils.ValidatePlan(plan)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	plan.ToRemove = s.Protected.FilterRemovals(plan.ToRemove)
+	if !req.DryRun {
+		srv.applyMu.Lock()
+		defer srv.applyMu.Unlock()
+	}
+	subscribed, err := FetchSubscriptions(srv.RedditToken)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	diff := utils.DiffPlan(plan, subscribed)
+	if req.DryRun {
+		writeJSON(w, http.StatusOK, diff)
+		return
+	}
+
+	plan = utils.DropStale(plan, diff)
+	if _, err := utils.SavePlanDocument(s.PlanDocument(plan), "api"); err != nil {
+		log.Printf("saving applied plan: %v", err)
+	}
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		srv.streamApply(w, s, plan, fromSession)
+		return
+	}
+	results := ApplyPlan(plan, srv.RedditToken, s.Protected, os.Stderr)
+	if results == nil {
+		results = []models.ApplyResult{}
+	}
+	if fromSession {
+		s.Plan = models.RecommendationPlan{}
+	}
+	status := http.StatusOK
+	if ApplyFailures(results) > 0 {
+		status = http.StatusMultiStatus
+	}
+	writeJSON(w, status, results)
+}
+
+// streamApply applies plan, writing each result as a line of JSON.
+func (srv *Server) streamApply(w http.ResponseWriter, s *Session, plan models.RecommendationPlan, fromSession bool) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	send := func(v any) {
+		enc.Encode(v)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	send(map[string]int{"total": len(plan.ToAdd) + len(plan.ToRemove)})
+	results := ApplyPlanProgress(plan, srv.RedditToken, s.Protected, os.Stderr, func(r models.ApplyResult) { send(r) })
+	if fromSession {
+		s.Plan = models.RecommendationPlan{}
+	}
+	failed, skipped := ApplyFailures(results), ApplySkipped(results)
+	send(map[string]any{"done": true, "applied": len(results) - failed - skipped, "failed": failed, "skipped": skipped})
+}
+
+func (srv *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	records, err := utils.LoadApplyLog()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if records == nil {
+		records = []models.ApplyRecord{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (srv *Server) handleListPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := utils.ListPlanDocuments()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, plans)
+}
+
+func (srv *Server) handleGetSavedPlan(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".json") {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid plan name %q", name))
+		return
+	}
+	doc, err := utils.LoadPlanDocument(filepath.Join(utils.PlanDir(), name))
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no saved plan %q", name))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// parsePlanJSON accepts a saved plan document or a bare plan.
+func parsePlanJSON(data []byte) (models.RecommendationPlan, error) {
+	var probe struct {
+		Schema int `json:"schema"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return models.RecommendationPlan{}, fmt.Errorf("invalid plan: %w", err)
+	}
+	if probe.Schema != 0 {
+		var doc models.PlanDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return models.RecommendationPlan{}, fmt.Errorf("invalid plan: %w", err)
+		}
+		return utils.PlanFromDocument(doc), nil
+	}
+	var plan models.RecommendationPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return plan, fmt.Errorf("invalid plan: %w", err)
+	}
+	return plan, nil
+}
+
+func decodeBody(r *http.Request, v any) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
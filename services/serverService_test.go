@@ -0,0 +1,289 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+)
+
+const testAPIKey = "test-key"
+
+// newTestServer returns a server whose files all live in a temporary
+// directory.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("REDDMEIT_CONFIG_DIR", dir)
+	t.Setenv("REDDMEIT_LOG_DIR", dir)
+	t.Setenv("REDDMEIT_PLAN_DIR", dir)
+	t.Setenv("REDDMEIT_APPLY_LOG", dir+"/apply_log.json")
+	t.Setenv("REDDMEIT_PROTECTED_FILE", dir+"/protected.json")
+	t.Setenv("REDDMEIT_PREFERENCES_FILE", dir+"/preferences.json")
+	t.Setenv("REDDMEIT_PROTECTED", "")
+	t.Setenv("REDDMEIT_MERGE_POLICY", "")
+	t.Setenv("REDDMEIT_API_KEY", testAPIKey)
+	t.Setenv("REDDIT_ACCESS_TOKEN", "token")
+	t.Setenv("REDDIT_USERNAME", "")
+	return NewServer()
+}
+
+// call sends a request the way the dashboard does and decodes the JSON
+// reply into out, if given.
+func call(t *testing.T, srv *Server, method, path, session, body string, out any) int {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Host = "127.0.0.1:8787"
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set("X-Reddmeit-Session", session)
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// stubReddit answers Reddit API calls with handler for the rest of the test.
+func stubReddit(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	saved := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Result(), nil
+	})
+	t.Cleanup(func() { http.DefaultTransport = saved })
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestServerGuard(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		edit   func(r *http.Request)
+		want   int
+	}{
+		{"dashboard needs no key", "GET", "/", func(r *http.Request) { r.Header.Del("Authorization") }, http.StatusOK},
+		{"api without key", "GET", "/api/plan", func(r *http.Request) { r.Header.Del("Authorization") }, http.StatusUnauthorized},
+		{"api with wrong key", "GET", "/api/plan", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"rebound host", "GET", "/api/plan", func(r *http.Request) { r.Host = "evil.example:8787" }, http.StatusForbidden},
+		{"localhost", "GET", "/api/plan", func(r *http.Request) { r.Host = "localhost:8787" }, http.StatusOK},
+		{"ipv6 loopback", "GET", "/api/plan", func(r *http.Request) { r.Host = "[::1]:8787" }, http.StatusOK},
+		{"same origin", "DELETE", "/api/plan", func(r *http.Request) { r.Header.Set("Origin", "http://127.0.0.1:8787") }, http.StatusNoContent},
+		{"other origin", "DELETE", "/api/plan", func(r *http.Request) { r.Header.Set("Origin", "http://evil.example") }, http.StatusForbidden},
+		{"null origin", "DELETE", "/api/plan", func(r *http.Request) { r.Header.Set("Origin", "null") }, http.StatusForbidden},
+		{"form post", "POST", "/api/plan/merge", func(r *http.Request) { r.Header.Set("Content-Type", "text/plain") }, http.StatusUnsupportedMediaType},
+		{"no content type", "DELETE", "/api/plan", func(r *http.Request) { r.Header.Del("Content-Type") }, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Host = "127.0.0.1:8787"
+			req.Header.Set("Authorization", "Bearer "+testAPIKey)
+			req.Header.Set("Content-Type", "application/json")
+			tt.edit(req)
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got %d (%s), want %d", rec.Code, strings.TrimSpace(rec.Body.String()), tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServerGeneratesKey(t *testing.T) {
+	srv := newTestServer(t)
+	t.Setenv("REDDMEIT_API_KEY", "")
+	a, b := NewServer(), NewServer()
+	if a.APIKey == "" || a.APIKey == b.APIKey {
+		t.Errorf("generated keys %q and %q, want distinct non-empty keys", a.APIKey, b.APIKey)
+	}
+	if srv.APIKey != testAPIKey {
+		t.Errorf("APIKey = %q, want REDDMEIT_API_KEY", srv.APIKey)
+	}
+}
+
+func TestServerSessions(t *testing.T) {
+	srv := newTestServer(t)
+	var doc models.PlanDocument
+	if code := call(t, srv, "PUT", "/api/plan", "alice", `{"to_add": ["r/books"]}`, &doc); code != http.StatusOK {
+		t.Fatalf("PUT /api/plan = %d", code)
+	}
+	call(t, srv, "GET", "/api/plan", "bob", "", &doc)
+	if len(doc.Items) != 0 {
+		t.Errorf("bob sees alice's plan: %+v", doc.Items)
+	}
+	call(t, srv, "GET", "/api/plan", "alice", "", &doc)
+	if len(doc.Items) != 1 || doc.Items[0].Subreddit != "r/books" {
+		t.Errorf("alice's plan = %+v, want r/books", doc.Items)
+	}
+
+	// The /edit text format comes wrapped in JSON.
+	body := `{"text": "+ r/books  # still want it\n- r/news\n"}`
+	if code := call(t, srv, "PUT", "/api/plan", "alice", body, &doc); code != http.StatusOK {
+		t.Fatalf("PUT /api/plan with text = %d", code)
+	}
+	if len(doc.Items) != 2 || doc.Items[0].Reason != "still want it" {
+		t.Errorf("plan from text = %+v", doc.Items)
+	}
+	var failure map[string]string
+	if code := call(t, srv, "PUT", "/api/plan", "alice", `{"text": "r/books"}`, &failure); code != http.StatusBadRequest {
+		t.Errorf("bad plan text = %d, want 400", code)
+	}
+}
+
+func TestServerSessionLimits(t *testing.T) {
+	srv := newTestServer(t)
+	for i := 0; i < maxSessions; i++ {
+		if _, err := srv.session(string(rune('a'+i%26)) + strings.Repeat("x", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldest := "a"
+	srv.sessions[oldest].lastUsed = time.Now().Add(-time.Hour)
+	if _, err := srv.session("newcomer"); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.sessions) != maxSessions {
+		t.Errorf("%d sessions kept, want %d", len(srv.sessions), maxSessions)
+	}
+	if _, ok := srv.sessions[oldest]; ok {
+		t.Error("the least recently used session was kept")
+	}
+
+	srv.sessions["newcomer"].lastUsed = time.Now().Add(-sessionIdleTimeout - time.Minute)
+	if _, err := srv.session("b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.sessions["newcomer"]; ok {
+		t.Error("an idle session was kept")
+	}
+}
+
+func TestServerMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		want      int
+		items     int
+		conflicts int
+	}{
+		{"latest", `{"plan": {"to_remove": ["books"], "to_add": ["r/pics"]}}`, http.StatusOK, 2, 1},
+		{"drop", `{"plan": {"to_remove": ["books"]}, "policy": "drop"}`, http.StatusOK, 0, 1},
+		{"no conflict", `{"plan": {"to_add": ["r/pics"]}}`, http.StatusOK, 2, 0},
+		{"ask needs a person", `{"plan": {"to_add": ["r/pics"]}, "policy": "ask"}`, http.StatusBadRequest, 0, 0},
+		{"unknown policy", `{"plan": {"to_add": ["r/pics"]}, "policy": "maybe"}`, http.StatusBadRequest, 0, 0},
+		{"unknown field", `{"plan": {"to_add": ["r/pics"]}, "extra": 1}`, http.StatusBadRequest, 0, 0},
+		{"invalid subreddit", `{"plan": {"to_add": ["not a sub!"]}}`, http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			call(t, srv, "PUT", "/api/plan", "", `{"to_add": ["r/books"]}`, nil)
+			var resp struct {
+				Plan      models.PlanDocument   `json:"plan"`
+				Conflicts []utils.MergeConflict `json:"conflicts"`
+				Error     string                `json:"error"`
+			}
+			code := call(t, srv, "POST", "/api/plan/merge", "", tt.body, &resp)
+			if code != tt.want {
+				t.Fatalf("got %d (%s), want %d", code, resp.Error, tt.want)
+			}
+			if code != http.StatusOK {
+				if resp.Error == "" {
+					t.Error("error response without a message")
+				}
+				return
+			}
+			if len(resp.Plan.Items) != tt.items || len(resp.Conflicts) != tt.conflicts {
+				t.Errorf("got %d items and %d conflicts, want %d and %d", len(resp.Plan.Items), len(resp.Conflicts), tt.items, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestServerApply(t *testing.T) {
+	srv := newTestServer(t)
+	var subscribed []string
+	stubReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subreddits/mine/subscriber":
+			if subscribed == nil {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			var children []map[string]any
+			for _, name := range subscribed {
+				children = append(children, map[string]any{"data": map[string]string{"display_name": name}})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"children": children}})
+		case "/api/subscribe":
+			w.Write([]byte("{}"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	call(t, srv, "PUT", "/api/plan", "", `{"to_add": ["r/books", "r/pics"]}`, nil)
+	var failure map[string]string
+	if code := call(t, srv, "POST", "/api/apply", "", `{}`, &failure); code != http.StatusBadGateway {
+		t.Fatalf("apply with subscriptions unavailable = %d, want 502", code)
+	}
+
+	subscribed = []string{"books"}
+	var diff models.PlanDiff
+	if code := call(t, srv, "POST", "/api/apply", "", `{"dry_run": true}`, &diff); code != http.StatusOK {
+		t.Fatalf("dry run = %d", code)
+	}
+	if len(diff.ToAdd) != 1 || len(diff.AlreadySubscribed) != 1 {
+		t.Errorf("dry run diff = %+v, want r/pics to add and r/books already subscribed", diff)
+	}
+
+	var results []models.ApplyResult
+	if code := call(t, srv, "POST", "/api/apply", "", `{}`, &results); code != http.StatusOK {
+		t.Fatalf("apply = %d", code)
+	}
+	if len(results) != 1 || results[0].Subreddit != "r/pics" || !results[0].OK {
+		t.Errorf("results = %+v, want r/pics subscribed", results)
+	}
+	records, err := utils.LoadApplyLog()
+	if err != nil || len(records) != 1 {
+		t.Errorf("apply log = %+v, %v; want one entry", records, err)
+	}
+	var doc models.PlanDocument
+	call(t, srv, "GET", "/api/plan", "", "", &doc)
+	if len(doc.Items) != 0 {
+		t.Errorf("session plan after apply = %+v, want it cleared", doc.Items)
+	}
+}
+
+func TestServerRecommendErrors(t *testing.T) {
+	srv := newTestServer(t)
+	var failure map[string]string
+	for _, body := range []string{`{"prompt": "  "}`, `{"prompt": 1}`, `{"question": "hi"}`} {
+		if code := call(t, srv, "POST", "/api/recommend", "", body, &failure); code != http.StatusBadRequest || failure["error"] == "" {
+			t.Errorf("POST /api/recommend %s = %d %v, want 400 with an error", body, code, failure)
+		}
+	}
+}
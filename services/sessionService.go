@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/controllers"
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/prompts"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Session is one user's conversation with the assistant: the chat history,
+// the plan being built, what has already been suggested, the user's
+// preferences and the clients used to answer. Sessions share no state, so
+// the CLI, a server or a test can run several side by side; calls on a
+// single Session must not overlap.
+type Session struct {
+	History *Conversation
+	Plan    models.RecommendationPlan // the plan the user is building
+	Shown   []string                  // suggestions already shown, without r/
+	Account string                    // Reddit username, recorded in saved plans
+
+	// UserPrompts is what the user asked for, in order.
+	UserPrompts []string
+	Prefs       models.Preferences
+	Protected   *utils.ProtectedList
+
+	// Skipped holds subreddits and topics the user turned down in this
+	// session ("not art", "skip r/x"), in BlockedSubs and BlockedTopics.
+	// They are filtered out like blocked preferences but not saved to
+	// the preference profile; /block does that.
+	Skipped models.Preferences
+
+	Client      *openai.Client // created from OPENAI_API_KEY when nil
+	Cache       *CompletionCache
+	Prompts     *prompts.Set
+	Model       string
+	Agent       bool // answer with Reddit tool calling
+	MergePolicy utils.MergePolicy
+	RedditToken string // used by the agent's tools
+
+	// Log receives warnings and progress messages; nil means stderr.
+	Log io.Writer
+
+	// lastSuggestion is the most recent plan returned by HandleRequest,
+	// which "skip r/x" feedback is applied to.
+	lastSuggestion models.RecommendationPlan
+}
+
+// NewSession returns an empty session configured from the environment.
+// Preferences and the protected list are left empty for the caller to load.
+func NewSession() *Session {
+	policy, err := utils.DefaultMergePolicy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  %v; using %s\n", err, policy)
+	}
+	return &Session{
+		History:     NewConversation(),
+		Cache:       NewCompletionCache(),
+		Prompts:     prompts.Default(),
+		Model:       chatModel(),
+		Agent:       agentEnabled(),
+		MergePolicy: policy,
+		RedditToken: os.Getenv("REDDIT_ACCESS_TOKEN"),
+	}
+}
+
+// client returns the session's OpenAI client, creating it on first use.
+func (s *Session) client() (*openai.Client, error) {
+	if s.Client != nil {
+		return s.Client, nil
+	}
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY unset")
+	}
+	s.Client = openai.NewClient(apiKey)
+	return s.Client, nil
+}
+
+// ClassifyIntent works like the package-level ClassifyIntent but reuses the
+// session's client and prompt templates.
+func (s *Session) ClassifyIntent(ctx context.Context, input string) controllers.Intent {
+	intent := controllers.ParseConversationIntent(input)
+	if intent.Confidence >= controllers.ConfidentIntent {
+		return intent
+	}
+	client, err := s.client()
+	if err != nil {
+		s.logf("⚠️  Intent classifier unavailable, using best guess: %v\n", err)
+		return intent
+	}
+	return classifyWithGPT(ctx, client, s.promptSet(), intent, s.logWriter())
+}
+
+// logWriter returns the session's Log, or stderr.
+func (s *Session) logWriter() io.Writer {
+	if s.Log == nil {
+		return os.Stderr
+	}
+	return s.Log
+}
+
+// logf writes a warning or progress message to the session's Log.
+func (s *Session) logf(format string, args ...any) {
+	fmt.Fprintf(s.logWriter(), format, args...)
+}
+
+// promptSet returns the session's prompt templates, or the default ones.
+func (s *Session) promptSet() *prompts.Set {
+	if s.Prompts == nil {
+		return prompts.Default()
+	}
+	return s.Prompts
+}
+
+// filterShown drops subreddits that were already suggested earlier in the
+// session, in case the model repeats itself anyway.
+func (s *Session) filterShown(subs []string) []string {
+	var fresh []string
+	for _, sub := range subs {
+		if containsSub(s.Shown, sub) {
+			s.logf("↩️  Skipped %s: already suggested.\n", sub)
+			continue
+		}
+		fresh = append(fresh, sub)
+	}
+	return fresh
+}
+
+// rememberShown records suggestions shown to the user so a later "more"
+// request can exclude them.
+func (s *Session) rememberShown(subs []string) {
+	for _, sub := range subs {
+		name := strings.TrimPrefix(sub, "r/")
+		found := false
+		for _, seen := range s.Shown {
+			if strings.EqualFold(seen, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.Shown = append(s.Shown, name)
+		}
+	}
+}
+
+// State returns what is needed to resume the session later.
+func (s *Session) State() models.SessionState {
+	return models.SessionState{
+		SavedAt:        time.Now(),
+		Plan:           s.Plan,
+		LastSuggestion: s.lastSuggestion,
+		Conversation:   s.History.Export(),
+		Shown:          s.Shown,
+		Prompts:        s.UserPrompts,
+		SkippedSubs:    s.Skipped.BlockedSubs,
+		SkippedTopics:  s.Skipped.BlockedTopics,
+	}
+}
+
+// Restore replaces the session's plan, history and suggestions with a saved
+// state.
+func (s *Session) Restore(state models.SessionState) {
+	s.Plan = state.Plan
+	s.lastSuggestion = state.LastSuggestion
+	s.History = ImportConversation(state.Conversation)
+	s.Shown = state.Shown
+	s.UserPrompts = state.Prompts
+	s.Skipped = models.Preferences{BlockedSubs: state.SkippedSubs, BlockedTopics: state.SkippedTopics}
+}
+
+// activePrefs is the preference profile plus what was skipped in this
+// session.
+func (s *Session) activePrefs() models.Preferences {
+	prefs := s.Prefs
+	prefs.BlockedSubs = append(append([]string(nil), s.Prefs.BlockedSubs...), s.Skipped.BlockedSubs...)
+	prefs.BlockedTopics = append(append([]string(nil), s.Prefs.BlockedTopics...), s.Skipped.BlockedTopics...)
+	return prefs
+}
+
+// PlanDocument wraps plan with the session's metadata for saving.
+func (s *Session) PlanDocument(plan models.RecommendationPlan) models.PlanDocument {
+	return utils.NewPlanDocument(plan, utils.PlanMeta{
+		Account:      s.Account,
+		Prompts:      s.UserPrompts,
+		Model:        s.Model,
+		Conversation: s.History.Export(),
+	})
+}
+
+// Empty reports whether nothing has happened in the session yet.
+func (s *Session) Empty() bool {
+	return len(s.Plan.ToAdd) == 0 && len(s.Plan.ToRemove) == 0 &&
+		len(s.History.Export()) == 0
+}
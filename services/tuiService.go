@@ -0,0 +1,1037 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"github.com/HenryArin/ReddmeitAlpha/utils"
+)
+
+type tuiPane int
+
+const (
+	paneInput tuiPane = iota
+	panePlan
+	paneSubs
+	paneChat
+)
+
+var paneNames = map[tuiPane]string{paneInput: "Prompt", panePlan: "Plan", paneSubs: "Subscriptions", paneChat: "Conversation"}
+
+// Subscription orders offered by "s" in the subscriptions pane.
+var subsSorts = []string{"engagement", "name", "least engaged"}
+
+type tuiMessage struct {
+	kind string // "user", "assistant", "info" or "error"
+	text string
+}
+
+// tuiRow is a line of the plan pane: a category heading or a change.
+type tuiRow struct {
+	heading string
+	sub     string
+	remove  bool
+}
+
+// tuiQuestion is a question from the session engine (st.ask) waiting for
+// an answer typed in the prompt line.
+type tuiQuestion struct {
+	text   string
+	answer chan string
+}
+
+// tui is the full-screen terminal UI. It drives the same interactiveState
+// as RunInteractiveSession; slow work (requests to the model or Reddit, and
+// anything that may ask a question) runs on a background goroutine while
+// the screen keeps updating. Only one such job runs at a time, and the UI
+// reads the session only through the copies published by sync.
+type tui struct {
+	st     *interactiveState
+	screen *utils.Screen
+	events chan func()
+	done   chan struct{}
+
+	// Copies of the session drawn by the UI.
+	plan       models.RecommendationPlan
+	subscribed map[string]bool
+	upvoted    map[string]bool
+	commented  map[string]bool
+
+	focus    tuiPane
+	input    []rune
+	question *tuiQuestion
+	busy     string
+	cancel   context.CancelFunc
+	status   string
+	popup    []string // description or help overlay; nil when hidden
+
+	chat       []tuiMessage
+	chatScroll int // lines scrolled back from the newest
+
+	rejected   map[string]bool
+	category   string // plan filter; "" shows every category
+	planCursor int    // index into the plan's change rows
+	subsSort   int
+	subsCursor int
+}
+
+// RunTUI starts the full-screen terminal UI. With resume set it continues
+// the last autosaved session, like RunInteractiveSession.
+func RunTUI(resume bool) error {
+	if err := utils.LoadEnv(); err != nil {
+		return err
+	}
+	token := os.Getenv("REDDIT_ACCESS_TOKEN")
+	user := os.Getenv("REDDIT_USERNAME")
+	if token == "" || user == "" {
+		return fmt.Errorf("missing REDDIT_ACCESS_TOKEN or REDDIT_USERNAME")
+	}
+
+	t := &tui{
+		events:   make(chan func(), 256),
+		done:     make(chan struct{}),
+		rejected: map[string]bool{},
+	}
+	st, err := newInteractiveState(token, user, t.ask)
+	if err != nil {
+		return err
+	}
+	t.st = st
+
+	screen, err := utils.OpenScreen()
+	if err != nil {
+		return err
+	}
+	t.screen = screen
+
+	// The engine reports progress with fmt.Printf; show it in the
+	// conversation instead of letting it scribble over the screen.
+	restore, err := t.captureOutput()
+	if err != nil {
+		screen.Close()
+		return err
+	}
+
+	t.say("info", "Type what you're into and press Enter. Tab switches panes, ? shows the keys.")
+	if resume {
+		if err := t.st.resume(false); err != nil {
+			t.say("error", "resume: "+err.Error())
+		}
+	} else if saved, ok := t.st.noteSavedSession(); ok {
+		t.say("info", fmt.Sprintf("You have a session saved %s; type /resume to continue it.", saved.SavedAt.Local().Format("2006-01-02 15:04")))
+	}
+	t.sync(false)
+	t.run("Loading your subscriptions", func(ctx context.Context) {
+		t.st.refreshActivity()
+	})
+
+	t.loop()
+
+	if t.cancel != nil {
+		t.cancel()
+	}
+	close(t.done)
+	restore()
+	screen.Close()
+	t.st.autosave()
+	if !t.st.Empty() {
+		fmt.Println("💾 Your session is saved; run with --resume to pick it up again.")
+	}
+	return nil
+}
+
+// loop draws the screen and handles keys and finished work until the user
+// quits.
+func (t *tui) loop() {
+	keys := t.screen.Keys()
+	resize := time.NewTicker(300 * time.Millisecond)
+	defer resize.Stop()
+	width, height := t.screen.Size()
+	for {
+		t.draw()
+		select {
+		case key, ok := <-keys:
+			if !ok || t.handleKey(key) {
+				return
+			}
+		case f := <-t.events:
+			f()
+		case <-resize.C:
+			if w, h := t.screen.Size(); w == width && h == height {
+				continue
+			} else {
+				width, height = w, h
+			}
+		}
+	}
+}
+
+// post runs f on the UI goroutine.
+func (t *tui) post(f func()) {
+	select {
+	case t.events <- f:
+	case <-t.done:
+	}
+}
+
+// sync copies what the UI shows from the session. It must run on the
+// goroutine that owns the session at the time; background is set when that
+// is background work, so the copy is handed to the UI goroutine instead of
+// applied directly.
+func (t *tui) sync(background bool) {
+	plan := utils.ClonePlan(t.st.Plan)
+	subscribed, upvoted, commented := t.st.subscribed, t.st.upvoted, t.st.commented
+	update := func() {
+		t.plan = plan
+		t.subscribed, t.upvoted, t.commented = subscribed, upvoted, commented
+		t.clampCursors()
+	}
+	if background {
+		t.post(update)
+	} else {
+		update()
+	}
+}
+
+// run does work on a background goroutine, which owns the session until it
+// finishes. Ctrl-C cancels ctx.
+func (t *tui) run(label string, work func(ctx context.Context)) {
+	if t.busy != "" {
+		t.status = "Still busy: " + t.busy
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.busy, t.cancel = label, cancel
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.post(func() { t.say("error", fmt.Sprint(r)) })
+			}
+			t.st.autosave()
+			t.sync(true)
+			t.post(func() {
+				t.busy, t.cancel = "", nil
+				cancel()
+			})
+		}()
+		work(ctx)
+	}()
+}
+
+// ask shows a question from the engine and waits for the answer typed at
+// the prompt. It is called from background work.
+func (t *tui) ask(question string) (string, error) {
+	answer := make(chan string, 1)
+	t.post(func() {
+		t.question = &tuiQuestion{text: question, answer: answer}
+		t.focus, t.input, t.popup = paneInput, nil, nil
+	})
+	select {
+	case a, ok := <-answer:
+		if !ok {
+			return "", utils.ErrInterrupted
+		}
+		return a, nil
+	case <-t.done:
+		return "", utils.ErrInterrupted
+	}
+}
+
+// captureOutput sends stdout and stderr to the conversation pane until the
+// returned function is called.
+func (t *tui) captureOutput() (restore func(), err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" {
+				t.post(func() { t.say("info", line) })
+			}
+		}
+	}()
+	return func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		w.Close()
+		<-finished
+		r.Close()
+	}, nil
+}
+
+func (t *tui) say(kind, text string) {
+	t.chat = append(t.chat, tuiMessage{kind: kind, text: text})
+	t.chatScroll = 0
+}
+
+// chatWriter streams the assistant's reply into the conversation pane.
+// Output printed while the reply streams adds messages of its own, so the
+// writer appends to the message it started rather than the last one.
+type chatWriter struct {
+	t       *tui
+	started bool
+	index   int // of the reply in t.chat; only used on the UI goroutine
+}
+
+func (w *chatWriter) Write(p []byte) (int, error) {
+	chunk, first := string(p), !w.started
+	w.started = true
+	w.t.post(func() {
+		if first {
+			w.t.say("assistant", "")
+			w.index = len(w.t.chat) - 1
+		}
+		w.t.chat[w.index].text += chunk
+	})
+	return len(p), nil
+}
+
+// ---- Input ----
+
+func (t *tui) handleKey(key utils.Key) (quit bool) {
+	if t.popup != nil {
+		t.popup = nil
+		return false
+	}
+	switch key.Name {
+	case "ctrl-c":
+		switch {
+		case t.question != nil:
+			close(t.question.answer)
+			t.question = nil
+		case t.cancel != nil:
+			t.cancel()
+			t.status = "Cancelling…"
+		case len(t.input) > 0:
+			t.input = nil
+		default:
+			return true
+		}
+		return false
+	case "ctrl-d":
+		return t.question == nil && t.busy == ""
+	case "tab":
+		t.focus = (t.focus + 1) % 4
+		return false
+	case "backtab":
+		t.focus = (t.focus + 3) % 4
+		return false
+	case "esc":
+		t.focus = paneInput
+		return false
+	}
+
+	switch t.focus {
+	case paneInput:
+		t.inputKey(key)
+	case panePlan:
+		return t.planKey(key)
+	case paneSubs:
+		return t.subsKey(key)
+	case paneChat:
+		return t.chatKey(key)
+	}
+	return false
+}
+
+func (t *tui) inputKey(key utils.Key) {
+	switch key.Name {
+	case "enter":
+		line := strings.TrimSpace(string(t.input))
+		t.input = nil
+		if t.question != nil {
+			t.say("user", line)
+			t.question.answer <- line
+			t.question = nil
+			return
+		}
+		if line != "" {
+			t.submit(line)
+		}
+	case "backspace":
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	case "ctrl-u":
+		t.input = nil
+	case "up", "down", "pgup", "pgdn":
+		t.chatKey(key)
+	case "":
+		t.input = append(t.input, key.Rune)
+	}
+}
+
+// submit sends a prompt or slash command typed at the prompt line.
+func (t *tui) submit(line string) {
+	t.say("user", line)
+	if IsSlashCommand(line) {
+		if name := strings.Fields(line)[0]; name == "/edit" {
+			t.say("error", "/edit needs the whole terminal; leave the TUI to use it, or edit the plan pane directly.")
+			return
+		}
+		t.run("Running "+strings.Fields(line)[0], func(ctx context.Context) {
+			if err := runSlashCommand(t.st, line); err != nil {
+				fmt.Printf("❌ %v\n", err)
+			}
+		})
+		return
+	}
+	t.run("Thinking", func(ctx context.Context) { t.turn(ctx, line) })
+}
+
+// turn runs one prompt through the session engine, as one iteration of
+// RunInteractiveSession's loop does.
+func (t *tui) turn(ctx context.Context, prompt string) {
+	st := t.st
+	intent := st.ClassifyIntent(ctx, prompt)
+	if intent.ShowPlan {
+		t.post(func() { t.focus = panePlan })
+		return
+	}
+	if intent.ClearRemoves {
+		st.snapshot()
+		st.Plan.ToRemove = nil
+		fmt.Println("🛑 Cleared all removals from the plan.")
+		return
+	}
+
+	st.refreshActivity()
+	result, err := st.HandleRequest(ctx, prompt, intent, st.subscribed, st.upvoted, st.commented, &chatWriter{t: t})
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("⏹️  Request cancelled.")
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Assistant error: %v\n", err)
+		return
+	}
+	if result.Cached {
+		fmt.Println("♻️  Reused a cached reply for this request.")
+	}
+
+	st.snapshot()
+	if result.ViewOnly {
+		reply := result.Reply
+		t.post(func() { t.say("assistant", reply) })
+	} else if len(result.Plan.ToAdd) == 0 && len(result.Plan.ToRemove) == 0 {
+		fmt.Println("🤖 No strong subreddit matches. Try rephrasing or being more specific?")
+	} else {
+		st.mergeSuggestion(result.Plan)
+		fmt.Printf("📋 %d change(s) suggested; see the plan pane.\n", len(result.Plan.ToAdd)+len(result.Plan.ToRemove))
+	}
+	st.Plan = ApplyFeedback(intent, st.Plan)
+	st.learnFromFeedback(intent)
+}
+
+// now runs a quick change to the session on the UI goroutine, if no
+// background work owns it.
+func (t *tui) now(change func()) {
+	if t.busy != "" {
+		t.status = "Still busy: " + t.busy
+		return
+	}
+	change()
+	t.st.autosave()
+	t.sync(false)
+}
+
+func (t *tui) planKey(key utils.Key) (quit bool) {
+	rows := t.planRows()
+	items := changeRows(rows)
+	var current *tuiRow
+	if t.planCursor < len(items) {
+		current = &items[t.planCursor]
+	}
+
+	switch {
+	case key.Name == "up" || key.Rune == 'k':
+		t.planCursor = max(t.planCursor-1, 0)
+	case key.Name == "down" || key.Rune == 'j':
+		t.planCursor = min(t.planCursor+1, max(len(items)-1, 0))
+	case key.Name == "pgup":
+		t.planCursor = max(t.planCursor-10, 0)
+	case key.Name == "pgdn":
+		t.planCursor = min(t.planCursor+10, max(len(items)-1, 0))
+	case key.Rune == ' ' && current != nil:
+		t.rejected[current.sub] = !t.rejected[current.sub]
+	case key.Rune == 'f':
+		t.nextCategory()
+	case (key.Name == "enter" || key.Rune == 'd') && current != nil:
+		t.showDetails(current.sub)
+	case key.Rune == 'x' && current != nil:
+		sub := current.sub
+		t.now(func() { runSlashCommand(t.st, "/drop "+sub) })
+	case key.Rune == 'u':
+		t.now(func() {
+			if err := runSlashCommand(t.st, "/undo"); err != nil {
+				fmt.Printf("❌ %v\n", err)
+			}
+		})
+	case key.Rune == 'a':
+		t.apply()
+	case key.Rune == '?':
+		t.showHelp()
+	case key.Rune == 'q':
+		return true
+	}
+	return false
+}
+
+func (t *tui) subsKey(key utils.Key) (quit bool) {
+	names := t.sortedSubs()
+	switch {
+	case key.Name == "up" || key.Rune == 'k':
+		t.subsCursor = max(t.subsCursor-1, 0)
+	case key.Name == "down" || key.Rune == 'j':
+		t.subsCursor = min(t.subsCursor+1, max(len(names)-1, 0))
+	case key.Name == "pgup":
+		t.subsCursor = max(t.subsCursor-10, 0)
+	case key.Name == "pgdn":
+		t.subsCursor = min(t.subsCursor+10, max(len(names)-1, 0))
+	case key.Rune == 's':
+		t.subsSort = (t.subsSort + 1) % len(subsSorts)
+		t.status = "Sorted by " + subsSorts[t.subsSort]
+	case (key.Name == "enter" || key.Rune == 'd') && t.subsCursor < len(names):
+		t.showDetails("r/" + names[t.subsCursor])
+	case key.Rune == 'r' && t.subsCursor < len(names):
+		name := names[t.subsCursor]
+		t.now(func() { runSlashCommand(t.st, "/remove r/"+name) })
+	case key.Rune == 'a':
+		t.apply()
+	case key.Rune == '?':
+		t.showHelp()
+	case key.Rune == 'q':
+		return true
+	}
+	return false
+}
+
+func (t *tui) chatKey(key utils.Key) (quit bool) {
+	switch {
+	case key.Name == "up" || key.Rune == 'k':
+		t.chatScroll++
+	case key.Name == "down" || key.Rune == 'j':
+		t.chatScroll = max(t.chatScroll-1, 0)
+	case key.Name == "pgup":
+		t.chatScroll += 10
+	case key.Name == "pgdn":
+		t.chatScroll = max(t.chatScroll-10, 0)
+	case key.Name == "end":
+		t.chatScroll = 0
+	case key.Rune == '?':
+		t.showHelp()
+	case key.Rune == 'q':
+		return true
+	}
+	return false
+}
+
+// nextCategory cycles the plan filter through the plan's categories.
+func (t *tui) nextCategory() {
+	categories := planCategories(t.plan)
+	next := ""
+	for i, c := range categories {
+		if c == t.category && i+1 < len(categories) {
+			next = categories[i+1]
+		}
+	}
+	if t.category == "" && len(categories) > 0 {
+		next = categories[0]
+	}
+	t.category, t.planCursor = next, 0
+	if next == "" {
+		t.status = "Showing every category"
+	} else {
+		t.status = "Showing " + next
+	}
+}
+
+// apply applies the accepted changes after asking, dropping the rejected
+// ones from the plan, and reports each result as it comes in.
+func (t *tui) apply() {
+	var accepted, rejected models.RecommendationPlan
+	for _, row := range changeRows(t.allRows()) {
+		target := &accepted
+		if t.rejected[row.sub] {
+			target = &rejected
+		}
+		if row.remove {
+			target.ToRemove = append(target.ToRemove, row.sub)
+		} else {
+			target.ToAdd = append(target.ToAdd, row.sub)
+		}
+	}
+	count := len(accepted.ToAdd) + len(accepted.ToRemove)
+	if count == 0 {
+		t.status = "Nothing accepted to apply."
+		return
+	}
+	t.run("Applying", func(ctx context.Context) {
+		st := t.st
+		if !st.confirm(fmt.Sprintf("⚠️  Apply %d change(s) and drop %d rejected? (yes/no)", count, len(rejected.ToAdd)+len(rejected.ToRemove))) {
+			fmt.Println("❌ Changes canceled.")
+			return
+		}
+		plan := subsetOf(st.Plan, accepted)
+		st.snapshot()
+		st.savePlan(plan, "tui_session")
+		// Each result is already printed into the conversation; the title
+		// bar counts them.
+		done := 0
+		ApplyPlanProgress(plan, st.token, st.Protected, os.Stdout, func(models.ApplyResult) {
+			done++
+			label := fmt.Sprintf("Applying %d/%d", done, count)
+			t.post(func() { t.busy = label })
+		})
+		st.learnAccepted()
+		st.rememberShown(rejected.ToAdd)
+		for _, sub := range append(append(accepted.ToAdd, accepted.ToRemove...), append(rejected.ToAdd, rejected.ToRemove...)...) {
+			st.Plan.ToAdd = withoutSub(st.Plan.ToAdd, sub)
+			st.Plan.ToRemove = withoutSub(st.Plan.ToRemove, sub)
+		}
+		if len(st.Plan.ToAdd) == 0 && len(st.Plan.ToRemove) == 0 {
+			st.History = NewConversation()
+			if err := utils.ClearSessionState(); err != nil {
+				fmt.Printf("⚠️  Failed to clear saved session: %v\n", err)
+			}
+		}
+		st.refreshActivity()
+		t.post(func() { t.rejected = map[string]bool{} })
+	})
+}
+
+// subsetOf returns the changes of plan listed in want, with their details.
+func subsetOf(plan, want models.RecommendationPlan) models.RecommendationPlan {
+	out := utils.ClonePlan(plan)
+	out.ToAdd, out.ToRemove = nil, nil
+	for _, sub := range plan.ToAdd {
+		if containsSub(want.ToAdd, sub) {
+			out.ToAdd = append(out.ToAdd, sub)
+		}
+	}
+	for _, sub := range plan.ToRemove {
+		if containsSub(want.ToRemove, sub) {
+			out.ToRemove = append(out.ToRemove, sub)
+		}
+	}
+	return out
+}
+
+// showDetails opens a popup with what Reddit says about sub. The lookup
+// only reads the token, so it can run alongside other work.
+func (t *tui) showDetails(sub string) {
+	t.popup = []string{sub, "", "Looking it up…"}
+	plan := t.plan
+	token := t.st.token
+	go func() {
+		lines := []string{sub}
+		defer func() {
+			if r := recover(); r != nil {
+				lines = append(lines, "", fmt.Sprint(r))
+			}
+			t.post(func() {
+				if len(t.popup) > 0 && t.popup[0] == sub {
+					t.popup = lines
+				}
+			})
+		}()
+		info, err := FetchSubredditAbout(sub, token)
+		if err != nil {
+			lines = append(lines, "", err.Error())
+			return
+		}
+		if info.Title != "" {
+			lines = append(lines, info.Title)
+		}
+		meta := utils.FormatMembers(info.Subscribers) + " members"
+		if info.Over18 {
+			meta += " · NSFW"
+		}
+		lines = append(lines, meta)
+		if reason := plan.Explanations[sub]; reason != "" {
+			lines = append(lines, "", "Why: "+reason)
+		}
+		if source := plan.Sources[sub]; source != "" {
+			lines = append(lines, fmt.Sprintf("Suggested by: %s (request confidence %.0f%%)", source, plan.RequestConfidence[sub]*100))
+		}
+		if info.Description != "" {
+			lines = append(lines, "", info.Description)
+		}
+	}()
+}
+
+func (t *tui) showHelp() {
+	t.popup = []string{
+		"Keys",
+		"",
+		"Tab / Shift-Tab   switch pane        Esc   back to the prompt",
+		"Enter             send the prompt    Ctrl-C   cancel, or quit",
+		"",
+		"Plan:           ↑/↓ move · Space accept/reject · f filter category",
+		"                d details · x drop · u undo · a apply accepted",
+		"Subscriptions:  ↑/↓ move · s sort · d details · r plan removal",
+		"Conversation:   ↑/↓ scroll",
+		"",
+		"In the subscriptions list, c = you commented there, u = you upvoted.",
+		"Slash commands such as /add r/books or /protect r/x work at the prompt.",
+		"q (outside the prompt) quits; the session is saved for --resume.",
+	}
+}
+
+// ---- Drawing ----
+
+func (t *tui) draw() {
+	s := t.screen
+	width, height := s.Size()
+	if width < 40 || height < 12 {
+		s.Put(0, 0, width, "Make the terminal bigger.", utils.StyleNone)
+		s.Flush()
+		return
+	}
+
+	title := " Reddmeit"
+	if t.st != nil && t.st.user != "" {
+		title += " · u/" + t.st.user
+	}
+	if t.busy != "" {
+		title += " · " + t.busy + "…"
+	}
+	s.Put(0, 0, width, title, utils.StyleReverse)
+
+	bodyTop, bodyHeight := 1, height-3
+	leftWidth := max(width/3, 24)
+	rightCol, rightWidth := leftWidth+1, width-leftWidth-1
+	planHeight := bodyHeight / 2
+	for row := bodyTop; row < bodyTop+bodyHeight; row++ {
+		s.Put(row, leftWidth, 1, "│", utils.StyleDim)
+	}
+	t.drawSubs(bodyTop, 0, leftWidth, bodyHeight)
+	t.drawPlan(bodyTop, rightCol, rightWidth, planHeight)
+	t.drawChat(bodyTop+planHeight, rightCol, rightWidth, bodyHeight-planHeight)
+
+	prompt := "> "
+	if t.question != nil {
+		prompt = t.question.text + " "
+	}
+	inputRow := height - 2
+	inputStyle := utils.StyleNone
+	if t.focus == paneInput {
+		inputStyle = utils.StyleBold
+	}
+	line := prompt + string(t.input)
+	// Keep the end of a long line in view.
+	for utils.StringWidth(line) > width-1 && len(line) > 0 {
+		_, size := firstRune(line)
+		line = line[size:]
+	}
+	s.Put(inputRow, 0, width, line, inputStyle)
+
+	status := t.status
+	if status == "" {
+		status = t.hints()
+	}
+	s.Put(height-1, 0, width, status, utils.StyleDim)
+	t.status = ""
+
+	if t.popup != nil {
+		t.drawPopup(width, height)
+	}
+	if t.focus == paneInput && t.popup == nil {
+		s.Cursor(inputRow, min(utils.StringWidth(line), width-1))
+	} else {
+		s.Cursor(-1, 0)
+	}
+	s.Flush()
+}
+
+func firstRune(s string) (rune, int) {
+	for i, r := range s {
+		if i > 0 {
+			return r, i
+		}
+	}
+	return 0, len(s)
+}
+
+func (t *tui) hints() string {
+	switch t.focus {
+	case panePlan:
+		return "Space accept/reject · f filter · d details · x drop · u undo · a apply · ? help"
+	case paneSubs:
+		return "s sort · d details · r plan removal · a apply · ? help"
+	case paneChat:
+		return "↑/↓ scroll · Tab next pane · ? help"
+	}
+	return "Enter send · /help commands · Tab switch pane · Ctrl-C quit"
+}
+
+func (t *tui) paneTitle(pane tuiPane, text string) (string, string) {
+	if t.focus == pane {
+		return " " + text, utils.StyleReverse + utils.StyleBold
+	}
+	return " " + text, utils.StyleBold
+}
+
+func (t *tui) drawSubs(top, col, width, height int) {
+	names := t.sortedSubs()
+	title, style := t.paneTitle(paneSubs, fmt.Sprintf("%s (%d) · by %s", paneNames[paneSubs], len(names), subsSorts[t.subsSort]))
+	t.screen.Put(top, col, width, title, style)
+	if t.subscribed == nil {
+		message := " Couldn't load them; see the conversation."
+		if t.busy != "" {
+			message = " Loading…"
+		}
+		t.screen.Put(top+1, col, width, message, utils.StyleDim)
+		return
+	}
+	rows := height - 1
+	first := scrollStart(t.subsCursor, len(names), rows)
+	for i := 0; i < rows && first+i < len(names); i++ {
+		name := names[first+i]
+		marks := []byte("··")
+		if t.commented[name] {
+			marks[0] = 'c'
+		}
+		if t.upvoted[name] {
+			marks[1] = 'u'
+		}
+		text := fmt.Sprintf(" %s r/%s", marks, name)
+		style := utils.StyleNone
+		if containsSub(t.plan.ToRemove, "r/"+name) {
+			text += "  (removing)"
+			style = utils.StyleRed
+		}
+		if t.focus == paneSubs && first+i == t.subsCursor {
+			style += utils.StyleReverse
+		}
+		t.screen.Put(top+1+i, col, width, text, style)
+	}
+}
+
+func (t *tui) drawPlan(top, col, width, height int) {
+	rows := t.planRows()
+	items := changeRows(rows)
+	label := fmt.Sprintf("%s (%d)", paneNames[panePlan], len(items))
+	if t.category != "" {
+		label += " · " + t.category
+	}
+	title, style := t.paneTitle(panePlan, label)
+	t.screen.Put(top, col, width, title, style)
+	if len(rows) == 0 {
+		t.screen.Put(top+1, col, width, " No changes yet. Ask for recommendations below.", utils.StyleDim)
+		return
+	}
+
+	// Find the cursor's row among the headings.
+	cursorRow, n := 0, 0
+	for i, row := range rows {
+		if row.sub != "" {
+			if n == t.planCursor {
+				cursorRow = i
+			}
+			n++
+		}
+	}
+	visible := height - 1
+	first := scrollStart(cursorRow, len(rows), visible)
+	for i := 0; i < visible && first+i < len(rows); i++ {
+		row := rows[first+i]
+		if row.heading != "" {
+			t.screen.Put(top+1+i, col, width, " "+row.heading, utils.StyleCyan)
+			continue
+		}
+		mark, sign, style := "[x]", "+", utils.StyleGreen
+		if row.remove {
+			sign, style = "-", utils.StyleRed
+		}
+		if t.rejected[row.sub] {
+			mark, style = "[ ]", utils.StyleDim
+		}
+		text := fmt.Sprintf("  %s %s %s", mark, sign, row.sub)
+		if reason := t.plan.Explanations[row.sub]; reason != "" {
+			text += " – " + reason
+		}
+		if t.focus == panePlan && first+i == cursorRow {
+			style += utils.StyleReverse
+		}
+		t.screen.Put(top+1+i, col, width, text, style)
+	}
+}
+
+func (t *tui) drawChat(top, col, width, height int) {
+	title, style := t.paneTitle(paneChat, paneNames[paneChat])
+	t.screen.Put(top, col, width, title, style)
+
+	type line struct{ text, style string }
+	var lines []line
+	for _, m := range t.chat {
+		prefix, style := "", utils.StyleNone
+		switch m.kind {
+		case "user":
+			prefix, style = "you: ", utils.StyleBold
+		case "info":
+			style = utils.StyleDim
+		case "error":
+			style = utils.StyleRed
+		}
+		for _, l := range utils.Wrap(prefix+m.text, width-2) {
+			lines = append(lines, line{l, style})
+		}
+	}
+	visible := height - 1
+	t.chatScroll = min(t.chatScroll, max(len(lines)-visible, 0))
+	end := len(lines) - t.chatScroll
+	start := max(end-visible, 0)
+	for i, l := range lines[start:end] {
+		t.screen.Put(top+1+i, col, width, " "+l.text, l.style)
+	}
+}
+
+func (t *tui) drawPopup(width, height int) {
+	boxWidth := min(width-4, 76)
+	var lines []string
+	for i, l := range t.popup {
+		if i == 0 {
+			lines = append(lines, l)
+			continue
+		}
+		lines = append(lines, utils.Wrap(l, boxWidth-4)...)
+	}
+	boxHeight := min(len(lines)+3, height-2)
+	top, left := (height-boxHeight)/2, (width-boxWidth)/2
+	border := "+" + strings.Repeat("-", boxWidth-2) + "+"
+	t.screen.Put(top, left, boxWidth, border, utils.StyleNone)
+	for i := 0; i < boxHeight-2; i++ {
+		text, style := "", utils.StyleNone
+		switch {
+		case i < len(lines) && i == 0:
+			text, style = lines[i], utils.StyleBold
+		case i < len(lines):
+			text = lines[i]
+		case i == boxHeight-3:
+			text, style = "any key to close", utils.StyleDim
+		}
+		t.screen.Put(top+1+i, left, 2, "| ", utils.StyleNone)
+		t.screen.Put(top+1+i, left+2, boxWidth-4, text, style)
+		t.screen.Put(top+1+i, left+boxWidth-2, 2, " |", utils.StyleNone)
+	}
+	t.screen.Put(top+boxHeight-1, left, boxWidth, border, utils.StyleNone)
+}
+
+// scrollStart returns the first row to show so cursor stays visible.
+func scrollStart(cursor, total, visible int) int {
+	if total <= visible || cursor < visible/2 {
+		return 0
+	}
+	return min(cursor-visible/2, total-visible)
+}
+
+// ---- Plan and subscription views ----
+
+// planRows lists the plan's changes under category headings, filtered by
+// the selected category.
+func (t *tui) planRows() []tuiRow {
+	rows := t.allRows()
+	if t.category == "" {
+		return rows
+	}
+	var filtered []tuiRow
+	keep := false
+	for _, row := range rows {
+		if row.heading != "" {
+			keep = row.heading == t.category
+		}
+		if keep {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
+
+func (t *tui) allRows() []tuiRow {
+	var rows []tuiRow
+	heading := ""
+	for _, it := range reviewItems(t.plan) {
+		if len(rows) == 0 || it.category != heading {
+			heading = it.category
+			rows = append(rows, tuiRow{heading: heading})
+		}
+		rows = append(rows, tuiRow{sub: it.sub, remove: it.remove})
+	}
+	return rows
+}
+
+func changeRows(rows []tuiRow) []tuiRow {
+	var items []tuiRow
+	for _, row := range rows {
+		if row.sub != "" {
+			items = append(items, row)
+		}
+	}
+	return items
+}
+
+// planCategories lists the categories in plan, in display order.
+func planCategories(plan models.RecommendationPlan) []string {
+	var categories []string
+	for _, it := range reviewItems(plan) {
+		if len(categories) == 0 || categories[len(categories)-1] != it.category {
+			categories = append(categories, it.category)
+		}
+	}
+	return categories
+}
+
+// sortedSubs lists the subscriptions in the chosen order. Engagement
+// counts a comment above an upvote.
+func (t *tui) sortedSubs() []string {
+	names := sortedNames(t.subscribed)
+	score := func(name string) int {
+		n := 0
+		if t.commented[name] {
+			n += 2
+		}
+		if t.upvoted[name] {
+			n++
+		}
+		return n
+	}
+	switch subsSorts[t.subsSort] {
+	case "engagement":
+		sort.SliceStable(names, func(i, j int) bool { return score(names[i]) > score(names[j]) })
+	case "least engaged":
+		sort.SliceStable(names, func(i, j int) bool { return score(names[i]) < score(names[j]) })
+	}
+	return names
+}
+
+func (t *tui) clampCursors() {
+	if n := len(changeRows(t.planRows())); t.planCursor >= n {
+		t.planCursor = max(n-1, 0)
+	}
+	if n := len(t.subscribed); t.subsCursor >= n {
+		t.subsCursor = max(n-1, 0)
+	}
+	if t.category != "" {
+		found := false
+		for _, c := range planCategories(t.plan) {
+			found = found || c == t.category
+		}
+		if !found {
+			t.category = ""
+		}
+	}
+}
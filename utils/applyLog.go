@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+// maxApplyLog is how many applies are kept for undo.
+const maxApplyLog = 50
+
+// ApplyLogFile returns where applied changes are recorded.
+// REDDMEIT_APPLY_LOG overrides the default, which is in LogDir.
+func ApplyLogFile() string {
+	if file := os.Getenv("REDDMEIT_APPLY_LOG"); file != "" {
+		return file
+	}
+	return filepath.Join(LogDir(), "apply_log.json")
+}
+
+// LoadApplyLog reads the apply log, oldest first. A missing file is an
+// empty log.
+func LoadApplyLog() ([]models.ApplyRecord, error) {
+	var records []models.ApplyRecord
+	data, err := os.ReadFile(ApplyLogFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%s: %w", ApplyLogFile(), err)
+	}
+	return records, nil
+}
+
+// applyLogMu serializes reading and rewriting the apply log, so appends
+// from concurrent applies don't lose each other's entries.
+var applyLogMu sync.Mutex
+
+// SaveApplyLog writes the apply log, keeping only the latest entries.
+func SaveApplyLog(records []models.ApplyRecord) error {
+	applyLogMu.Lock()
+	defer applyLogMu.Unlock()
+	return saveApplyLog(records)
+}
+
+// saveApplyLog writes the log through a temporary file renamed into place,
+// so a crash mid-write never leaves a truncated log behind.
+func saveApplyLog(records []models.ApplyRecord) error {
+	if len(records) > maxApplyLog {
+		records = records[len(records)-maxApplyLog:]
+	}
+	if records == nil {
+		records = []models.ApplyRecord{}
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := ApplyLogFile()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// AppendApplyLog records one apply.
+func AppendApplyLog(record models.ApplyRecord) error {
+	applyLogMu.Lock()
+	defer applyLogMu.Unlock()
+	records, err := LoadApplyLog()
+	if err != nil {
+		return err
+	}
+	return saveApplyLog(append(records, record))
+}
+
+// RemoveApplyRecord drops the entry recorded at appliedAt, leaving any
+// added since in place. It is how an undo takes its entry off the log.
+func RemoveApplyRecord(appliedAt time.Time) error {
+	applyLogMu.Lock()
+	defer applyLogMu.Unlock()
+	records, err := LoadApplyLog()
+	if err != nil {
+		return err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].AppliedAt.Equal(appliedAt) {
+			return saveApplyLog(append(records[:i], records[i+1:]...))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+)
+
+// Config is the settings file, config.toml in ConfigDir (REDDMEIT_CONFIG_FILE
+// overrides the path). Settings at the top apply to every profile, and each
+// [profiles.<name>] table overrides them:
+//
+//	default_profile = "personal"
+//	model = "gpt-4o"
+//
+//	[profiles.personal]
+//	env_file = "~/.config/reddmeit/personal.env"
+//	protected = ["r/AskHistorians"]
+//
+//	[profiles.work]
+//	reddit_username = "me_at_work"
+//	reddit_token_env = "WORK_REDDIT_TOKEN"
+//	output_format = "markdown"
+//
+// Settings only fill in environment variables that aren't already set, so
+// the environment and command-line flags win over the file. The file, in
+// turn, wins over .env (see LoadEnv).
+type Config struct {
+	Path     string
+	Default  string // default_profile
+	Base     ConfigSettings
+	Profiles map[string]ConfigSettings
+
+	// undecoded lists keys the file sets that no setting matches.
+	undecoded []string
+}
+
+// ConfigSettings holds one table of the file. Settings left out are nil, so
+// a profile only overrides what it sets.
+type ConfigSettings struct {
+	EnvFile           *string   `toml:"env_file"`
+	RedditUsername    *string   `toml:"reddit_username"`
+	RedditTokenEnv    *string   `toml:"reddit_token_env"`
+	OpenAIKeyEnv      *string   `toml:"openai_key_env"`
+	Model             *string   `toml:"model"`
+	Agent             *bool     `toml:"agent"`
+	AgentMaxToolCalls *int      `toml:"agent_max_tool_calls"`
+	ActivityThreshold *int      `toml:"activity_threshold"`
+	Protected         *[]string `toml:"protected"`
+	MergePolicy       *string   `toml:"merge_policy"`
+	OutputFormat      *string   `toml:"output_format"`
+	Color             *bool     `toml:"color"`
+	Cache             *bool     `toml:"cache"`
+	CacheDir          *string   `toml:"cache_dir"`
+	CacheTTL          *string   `toml:"cache_ttl"`
+	LogDir            *string   `toml:"log_dir"`
+	PlanDir           *string   `toml:"plan_dir"`
+	ServerAddr        *string   `toml:"server_addr"`
+}
+
+// configFile is the layout of config.toml.
+type configFile struct {
+	DefaultProfile string `toml:"default_profile"`
+	ConfigSettings
+	Profiles map[string]ConfigSettings `toml:"profiles"`
+}
+
+// configSetting describes a key the config file accepts.
+type configSetting struct {
+	key   string
+	env   string // the variable it provides a default for
+	check func(value string) error
+}
+
+var configSettings = []configSetting{
+	{"env_file", "", checkFileExists},
+	{"reddit_username", "REDDIT_USERNAME", nil},
+	{"reddit_token_env", "REDDIT_ACCESS_TOKEN", nil},
+	{"openai_key_env", "OPENAI_API_KEY", nil},
+	{"model", "REDDMEIT_MODEL", nil},
+	{"agent", "REDDMEIT_AGENT", nil},
+	{"agent_max_tool_calls", "REDDMEIT_AGENT_MAX_TOOL_CALLS", checkNonNegative},
+	{"activity_threshold", "REDDMEIT_ACTIVITY_THRESHOLD", checkActivityThreshold},
+	{"protected", "REDDMEIT_PROTECTED", checkSubreddits},
+	{"merge_policy", "REDDMEIT_MERGE_POLICY", func(v string) error { _, err := ParseMergePolicy(v); return err }},
+	{"output_format", "REDDMEIT_FORMAT", func(v string) error { _, err := ParseFormat(v); return err }},
+	{"color", "NO_COLOR", nil},
+	{"cache", "REDDMEIT_NO_CACHE", nil},
+	{"cache_dir", "REDDMEIT_CACHE_DIR", nil},
+	{"cache_ttl", "REDDMEIT_CACHE_TTL", func(v string) error { _, err := time.ParseDuration(v); return err }},
+	{"log_dir", "REDDMEIT_LOG_DIR", nil},
+	{"plan_dir", "REDDMEIT_PLAN_DIR", nil},
+	{"server_addr", "REDDMEIT_SERVER_ADDR", nil},
+}
+
+// ConfigFile returns where the config file is read from.
+func ConfigFile() string {
+	if file := os.Getenv("REDDMEIT_CONFIG_FILE"); file != "" {
+		return file
+	}
+	return filepath.Join(ConfigDir(), "config.toml")
+}
+
+// LoadConfig reads the config file. A missing file is an empty config.
+// Syntax errors and values of the wrong type fail with their line number.
+func LoadConfig() (Config, error) {
+	cfg := Config{Path: ConfigFile(), Profiles: map[string]ConfigSettings{}}
+	data, err := os.ReadFile(cfg.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	return parseConfig(cfg.Path, string(data))
+}
+
+// parseConfig decodes the contents of the config file at path.
+func parseConfig(path, data string) (Config, error) {
+	cfg := Config{Path: path, Profiles: map[string]ConfigSettings{}}
+	var file configFile
+	md, err := toml.Decode(data, &file)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Default = file.DefaultProfile
+	cfg.Base = file.ConfigSettings
+	for name, settings := range file.Profiles {
+		cfg.Profiles[name] = settings
+	}
+	for _, key := range md.Undecoded() {
+		cfg.undecoded = append(cfg.undecoded, key.String())
+	}
+	return cfg, nil
+}
+
+// ProfileNames lists the profiles in cfg, sorted.
+func (cfg Config) ProfileNames() []string {
+	var names []string
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the settings of the named profile on top of the shared
+// ones. An empty name picks REDDMEIT_PROFILE, then default_profile; with
+// neither, only the shared settings apply.
+func (cfg Config) Profile(name string) (string, ConfigSettings, error) {
+	if name == "" {
+		name = os.Getenv("REDDMEIT_PROFILE")
+	}
+	if name == "" {
+		name = cfg.Default
+	}
+	if name == "" {
+		return "", cfg.Base, nil
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return name, ConfigSettings{}, fmt.Errorf("no profile %q in %s", name, cfg.Path)
+	}
+	return name, cfg.Base.merge(profile), nil
+}
+
+// merge returns s with every setting over sets replaced by over's.
+func (s ConfigSettings) merge(over ConfigSettings) ConfigSettings {
+	merged := reflect.ValueOf(&s).Elem()
+	top := reflect.ValueOf(over)
+	for i := 0; i < top.NumField(); i++ {
+		if !top.Field(i).IsNil() {
+			merged.Field(i).Set(top.Field(i))
+		}
+	}
+	return s
+}
+
+// Validate checks every table for unknown keys and bad values, and that
+// default_profile exists.
+func (cfg Config) Validate() []error {
+	var problems []error
+	if cfg.Default != "" {
+		if _, ok := cfg.Profiles[cfg.Default]; !ok {
+			problems = append(problems, fmt.Errorf("%s: default_profile: no profile %q", cfg.Path, cfg.Default))
+		}
+	}
+	for _, key := range cfg.undecoded {
+		where, name := "", key
+		if rest, ok := strings.CutPrefix(key, "profiles."); ok {
+			if i := strings.LastIndex(rest, "."); i >= 0 {
+				where, name = "[profiles."+rest[:i]+"] ", rest[i+1:]
+			}
+		}
+		problems = append(problems, fmt.Errorf("%s: %sunknown setting %s", cfg.Path, where, name))
+	}
+	check := func(where string, settings ConfigSettings) {
+		values := settings.values()
+		for _, key := range sortedKeys(values) {
+			if err := checkSetting(key, values[key]); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %s%w", cfg.Path, where, err))
+			}
+		}
+	}
+	check("", cfg.Base)
+	for _, name := range cfg.ProfileNames() {
+		check("[profiles."+name+"] ", cfg.Profiles[name])
+	}
+	return problems
+}
+
+// values returns the settings that are set, by key, as the strings to put
+// in the environment.
+func (s ConfigSettings) values() map[string]string {
+	values := map[string]string{}
+	v := reflect.ValueOf(s)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.IsNil() {
+			continue
+		}
+		key := v.Type().Field(i).Tag.Get("toml")
+		var value string
+		switch x := field.Elem().Interface().(type) {
+		case string:
+			value = x
+		case int:
+			value = strconv.Itoa(x)
+		case bool:
+			value = strconv.FormatBool(x)
+		case []string:
+			value = strings.Join(x, ",")
+		}
+		if strings.HasSuffix(key, "_dir") || key == "env_file" {
+			value = expandHome(value)
+		}
+		values[key] = value
+	}
+	return values
+}
+
+// checkSetting runs the check for key, if it has one.
+func checkSetting(key, value string) error {
+	for _, spec := range configSettings {
+		if spec.key == key && spec.check != nil {
+			if err := spec.check(value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply sets the environment variables that settings provide defaults for.
+// Variables that are already set are left alone. dotenv holds variables
+// read from .env, which the file wins over but which *_env settings may
+// name. env_file is loaded before anything else, so the variables it sets
+// win over the file's other settings and can be named by *_env settings.
+func (s ConfigSettings) Apply(dotenv map[string]string) error {
+	var problems []error
+	setDefault := func(name, value string) {
+		if _, set := os.LookupEnv(name); !set && value != "" {
+			os.Setenv(name, value)
+		}
+	}
+	lookup := func(name string) string {
+		if value, set := os.LookupEnv(name); set {
+			return value
+		}
+		return dotenv[name]
+	}
+	values := s.values()
+	if file, ok := values["env_file"]; ok {
+		if err := checkSetting("env_file", file); err != nil {
+			problems = append(problems, err)
+		} else if err := godotenv.Load(file); err != nil {
+			problems = append(problems, fmt.Errorf("env_file: %w", err))
+		}
+		delete(values, "env_file")
+	}
+	for _, key := range sortedKeys(values) {
+		value := values[key]
+		if err := checkSetting(key, value); err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		switch key {
+		case "reddit_token_env", "openai_key_env":
+			if os.Getenv(settingEnv(key)) == "" && lookup(value) == "" {
+				problems = append(problems, fmt.Errorf("%s: %s is not set", key, value))
+			}
+			setDefault(settingEnv(key), lookup(value))
+		case "color":
+			// NO_COLOR turns color off; color = true leaves it unset.
+			if value == "false" {
+				setDefault("NO_COLOR", "1")
+			}
+		case "cache":
+			if value == "false" {
+				setDefault("REDDMEIT_NO_CACHE", "1")
+			}
+		default:
+			setDefault(settingEnv(key), value)
+		}
+	}
+	return errors.Join(problems...)
+}
+
+func settingEnv(key string) string {
+	for _, s := range configSettings {
+		if s.key == key {
+			return s.env
+		}
+	}
+	return ""
+}
+
+func sortedKeys(t map[string]string) []string {
+	var keys []string
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+func checkFileExists(path string) error {
+	_, err := os.Stat(path)
+	return err
+}
+
+func checkNonNegative(value string) error {
+	if n, _ := strconv.Atoi(value); n < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func checkActivityThreshold(value string) error {
+	if n, _ := strconv.Atoi(value); n < 1 || n > 3 {
+		return errors.New("must be 1, 2 or 3 (subscribed, upvoted and commented each count one)")
+	}
+	return nil
+}
+
+func checkSubreddits(value string) error {
+	if value == "" {
+		return nil
+	}
+	for _, name := range strings.Split(value, ",") {
+		if _, err := NormalizeSubreddit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleConfig = `
+default_profile = "personal"
+model = "gpt-4o"
+protected = ["r/AskHistorians"]
+
+[profiles.personal]
+agent = true
+
+[profiles.work]
+reddit_username = "me_at_work"
+model = "gpt-4o-mini"
+protected = []
+activity_threshold = 2
+`
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantErr  string // substring of the error, if any
+		profiles []string
+		def      string
+	}{
+		{name: "empty", data: ""},
+		{name: "sample", data: sampleConfig, profiles: []string{"personal", "work"}, def: "personal"},
+		{name: "quoted profile name", data: "[profiles.\"side project\"]\nmodel = 'gpt-4o'\n", profiles: []string{"side project"}},
+		{name: "multi-line list", data: "protected = [\n  \"r/a\",\n  \"r/b\",\n]\n"},
+		{name: "syntax error", data: "model = \"gpt-4o\"\nagent = \n", wantErr: "line 2"},
+		{name: "wrong type", data: "model = \"gpt-4o\"\n\n[profiles.x]\nagent = \"yes\"\n", wantErr: "line 4"},
+		{name: "list of numbers", data: "protected = [1, 2]\n", wantErr: "line 1"},
+		{name: "key set twice", data: "model = \"a\"\nmodel = \"b\"\n", wantErr: "line 2"},
+		{name: "profile defined twice", data: "[profiles.a]\n[profiles.a]\n", wantErr: "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig("config.toml", tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				if !strings.HasPrefix(err.Error(), "config.toml: ") {
+					t.Errorf("error %q doesn't name the file", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.ProfileNames(); !reflect.DeepEqual(got, tt.profiles) {
+				t.Errorf("profiles = %v, want %v", got, tt.profiles)
+			}
+			if cfg.Default != tt.def {
+				t.Errorf("default_profile = %q, want %q", cfg.Default, tt.def)
+			}
+		})
+	}
+}
+
+func TestConfigProfile(t *testing.T) {
+	cfg, err := parseConfig("config.toml", sampleConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, env string
+		want      string
+		values    map[string]string
+		wantErr   bool
+	}{
+		{
+			name: "", want: "personal",
+			values: map[string]string{"model": "gpt-4o", "protected": "r/AskHistorians", "agent": "true"},
+		},
+		{
+			name: "", env: "work", want: "work",
+			values: map[string]string{
+				"model": "gpt-4o-mini", "protected": "", "reddit_username": "me_at_work", "activity_threshold": "2",
+			},
+		},
+		{
+			name: "work", env: "personal", want: "work",
+			values: map[string]string{
+				"model": "gpt-4o-mini", "protected": "", "reddit_username": "me_at_work", "activity_threshold": "2",
+			},
+		},
+		{name: "missing", want: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			t.Setenv("REDDMEIT_PROFILE", tt.env)
+			got, settings, err := cfg.Profile(tt.name)
+			if got != tt.want {
+				t.Errorf("selected %q, want %q", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(settings.values(), tt.values) {
+				t.Errorf("settings = %v, want %v", settings.values(), tt.values)
+			}
+		})
+	}
+
+	// Merging must not change the shared settings.
+	if cfg.Base.values()["model"] != "gpt-4o" {
+		t.Errorf("base model changed to %q", cfg.Base.values()["model"])
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{name: "valid", data: sampleConfig},
+		{
+			name: "unknown keys",
+			data: "colour = true\n[profiles.work]\nmodle = \"x\"\n",
+			want: []string{"unknown setting colour", "[profiles.work] unknown setting modle"},
+		},
+		{
+			name: "bad values",
+			data: "merge_policy = \"sometimes\"\n[profiles.work]\nactivity_threshold = 5\ncache_ttl = \"soon\"\n",
+			want: []string{"merge_policy: unknown merge policy", "[profiles.work] activity_threshold: must be 1, 2 or 3", "[profiles.work] cache_ttl: "},
+		},
+		{
+			name: "bad subreddit",
+			data: "protected = [\"r/ok\", \"not a sub\"]\n",
+			want: []string{"protected: "},
+		},
+		{
+			name: "missing default profile",
+			data: "default_profile = \"home\"\n[profiles.work]\n",
+			want: []string{"default_profile: no profile \"home\""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig("config.toml", tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			problems := cfg.Validate()
+			if len(problems) != len(tt.want) {
+				t.Fatalf("problems = %v, want %d", problems, len(tt.want))
+			}
+			for i, problem := range problems {
+				if !strings.Contains(problem.Error(), tt.want[i]) {
+					t.Errorf("problem %d = %q, want it to mention %q", i, problem, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadEnvPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string // the process environment
+		dotenv  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "the file wins over .env",
+			dotenv: "REDDMEIT_MODEL=from-dotenv\nREDDIT_USERNAME=dotenv_user\n",
+			want:   map[string]string{"REDDMEIT_MODEL": "gpt-4o", "REDDIT_USERNAME": "dotenv_user"},
+		},
+		{
+			name:   "the environment wins over the file",
+			env:    map[string]string{"REDDMEIT_MODEL": "from-env"},
+			dotenv: "REDDMEIT_MODEL=from-dotenv\n",
+			want:   map[string]string{"REDDMEIT_MODEL": "from-env"},
+		},
+		{
+			name:   "an explicit profile wins over .env",
+			env:    map[string]string{"REDDMEIT_PROFILE": "work"},
+			dotenv: "REDDMEIT_PROFILE=personal\nREDDIT_USERNAME=dotenv_user\nREDDMEIT_MODEL=from-dotenv\n",
+			want:   map[string]string{"REDDIT_USERNAME": "me_at_work", "REDDMEIT_MODEL": "gpt-4o-mini", "REDDMEIT_AGENT": ""},
+		},
+		{
+			name:   ".env can pick the profile",
+			dotenv: "REDDMEIT_PROFILE=work\n",
+			want:   map[string]string{"REDDIT_USERNAME": "me_at_work", "REDDMEIT_PROFILE": "work"},
+		},
+		{
+			name:    "an unknown profile is an error",
+			env:     map[string]string{"REDDMEIT_PROFILE": "home"},
+			wantErr: true,
+		},
+	}
+	vars := []string{"REDDMEIT_PROFILE", "REDDMEIT_MODEL", "REDDIT_USERNAME", "REDDMEIT_AGENT",
+		"REDDMEIT_PROTECTED", "REDDMEIT_ACTIVITY_THRESHOLD"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, "config.toml")
+			if err := os.WriteFile(file, []byte(sampleConfig), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(tt.dotenv), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(dir)
+			t.Setenv("REDDMEIT_CONFIG_FILE", file)
+			for _, name := range vars {
+				// Registers the variable for restoring, then unsets it.
+				t.Setenv(name, "")
+				os.Unsetenv(name)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			err := LoadEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadEnv() = %v, want error %v", err, tt.wantErr)
+			}
+			for name, want := range tt.want {
+				if got := os.Getenv(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "personal.env")
+	data := "REDDMEIT_MODEL=from-env-file\nPERSONAL_REDDIT_TOKEN=secret\n"
+	if err := os.WriteFile(envFile, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"REDDMEIT_MODEL", "PERSONAL_REDDIT_TOKEN", "REDDIT_ACCESS_TOKEN"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	// env_file is loaded before the other settings, so its model wins and
+	// reddit_token_env can name a variable it sets.
+	cfg, err := parseConfig("config.toml", "env_file = '"+envFile+"'\nmodel = 'from-config'\nreddit_token_env = 'PERSONAL_REDDIT_TOKEN'\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Base.Apply(nil); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"REDDMEIT_MODEL": "from-env-file", "REDDIT_ACCESS_TOKEN": "secret"}
+	for name, value := range want {
+		if got := os.Getenv(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
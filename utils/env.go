@@ -1,14 +1,79 @@
 package utils
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/joho/godotenv"
 )
 
-func LoadEnv() {
-	err := godotenv.Load()
+// LoadEnv loads the selected profile of the config file (see Config) and
+// then .env from the working directory, if there is one. Neither replaces
+// variables that are already set, so the environment and command-line
+// flags win over the config file, and the config file over .env. A
+// profile can be picked with REDDMEIT_PROFILE in .env, but a profile chosen
+// with --profile or in the environment takes precedence.
+func LoadEnv() error {
+	dotenv, err := godotenv.Read()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf(".env: %w", err)
+	}
+	cfg, err := LoadConfig()
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return err
+	}
+	name := os.Getenv("REDDMEIT_PROFILE")
+	if name == "" {
+		name = dotenv["REDDMEIT_PROFILE"]
+	}
+	_, settings, err := cfg.Profile(name)
+	if err != nil {
+		return err
+	}
+	if err := settings.Apply(dotenv); err != nil {
+		return err
+	}
+	for key, value := range dotenv {
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	return nil
+}
+
+// ConfigDir returns the directory holding user-editable settings such as
+// prompt overrides. REDDMEIT_CONFIG_DIR takes precedence over the OS default.
+func ConfigDir() string {
+	if dir := os.Getenv("REDDMEIT_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return ".reddmeit"
+	}
+	return filepath.Join(base, "reddmeit")
+}
+
+// CacheDir returns the directory used for disposable data such as cached
+// model replies. REDDMEIT_CACHE_DIR takes precedence over the OS default.
+func CacheDir() string {
+	if dir := os.Getenv("REDDMEIT_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(".reddmeit", "cache")
+	}
+	return filepath.Join(base, "reddmeit")
+}
+
+// LogDir returns the directory for logs such as the apply log.
+// REDDMEIT_LOG_DIR takes precedence over ConfigDir.
+func LogDir() string {
+	if dir := os.Getenv("REDDMEIT_LOG_DIR"); dir != "" {
+		return dir
 	}
+	return ConfigDir()
 }
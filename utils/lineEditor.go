@@ -0,0 +1,357 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+const maxHistory = 500
+
+// LineEditor reads lines from the terminal with cursor movement, history
+// recall and tab completion. When stdin is not a terminal it falls back to
+// plain line reads, so piped input still works.
+//
+// Keys: ←/→, Home/End, Ctrl-A/E move; Backspace, Delete, Ctrl-K/U/W edit;
+// ↑/↓ recall history; Tab completes; Ctrl-C cancels the line; Ctrl-D on an
+// empty line ends input (io.EOF).
+type LineEditor struct {
+	// Complete returns candidate replacements for the last word of line.
+	Complete func(line string) []string
+
+	in          *os.File
+	out         io.Writer
+	reader      *bufio.Reader
+	history     []string
+	historyFile string
+	fileLines   int // lines in historyFile, to know when to compact it
+}
+
+// NewLineEditor returns an editor reading stdin. History is loaded from and
+// appended to historyFile; pass "" to keep history in memory only.
+func NewLineEditor(historyFile string) *LineEditor {
+	e := &LineEditor{
+		in:          os.Stdin,
+		out:         os.Stdout,
+		reader:      bufio.NewReader(os.Stdin),
+		historyFile: historyFile,
+	}
+	if historyFile != "" {
+		if data, err := os.ReadFile(historyFile); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if line != "" {
+					e.history = append(e.history, line)
+				}
+			}
+			e.fileLines = len(e.history)
+			if len(e.history) > maxHistory {
+				e.history = e.history[len(e.history)-maxHistory:]
+				e.compactHistory()
+			}
+		}
+	}
+	return e
+}
+
+// compactHistory rewrites the history file with only the lines kept in
+// memory, so the file doesn't grow forever.
+func (e *LineEditor) compactHistory() {
+	tmp := e.historyFile + ".tmp"
+	data := strings.Join(e.history, "\n") + "\n"
+	if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, e.historyFile); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	e.fileLines = len(e.history)
+}
+
+// HistoryFile returns where the session's input history is kept.
+// REDDMEIT_HISTORY_FILE overrides the default inside the config directory.
+func HistoryFile() string {
+	if file := os.Getenv("REDDMEIT_HISTORY_FILE"); file != "" {
+		return file
+	}
+	return filepath.Join(ConfigDir(), "history")
+}
+
+// AddHistory records line so it can be recalled with ↑, and persists it.
+func (e *LineEditor) AddHistory(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+	if e.historyFile == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.historyFile), 0o755); err != nil {
+		return
+	}
+	// Appending is cheap; the file is cut back to maxHistory lines once it
+	// holds twice that.
+	if e.fileLines >= 2*maxHistory {
+		e.compactHistory()
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, line); err == nil {
+		e.fileLines++
+	}
+}
+
+// ReadLine prints prompt and returns the line typed, without the newline.
+// It returns ErrInterrupted on Ctrl-C and io.EOF when input ends.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	fd := int(e.in.Fd())
+	if !term.IsTerminal(fd) {
+		return e.readPlain(prompt)
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer term.Restore(fd, state)
+	return e.readRaw(prompt)
+}
+
+func (e *LineEditor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	line, err := e.reader.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(e.out)
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// editState is the line being edited in raw mode.
+type editState struct {
+	prompt  string // last line of the prompt, redrawn on every change
+	buf     []rune
+	pos     int
+	histIdx int
+	saved   []rune // the line being typed before browsing history
+}
+
+func (e *LineEditor) readRaw(prompt string) (string, error) {
+	head, last := "", prompt
+	if i := strings.LastIndex(prompt, "\n"); i >= 0 {
+		head, last = prompt[:i+1], prompt[i+1:]
+	}
+	e.write(head)
+	s := &editState{prompt: last, histIdx: len(e.history)}
+	e.redraw(s)
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			e.write("\n")
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			e.write("\n")
+			return string(s.buf), nil
+		case 3: // Ctrl-C
+			e.write("^C\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(s.buf) == 0 {
+				e.write("\n")
+				return "", io.EOF
+			}
+			s.deleteAt(s.pos)
+		case 1: // Ctrl-A
+			s.pos = 0
+		case 5: // Ctrl-E
+			s.pos = len(s.buf)
+		case 2: // Ctrl-B
+			s.left()
+		case 6: // Ctrl-F
+			s.right()
+		case 11: // Ctrl-K
+			s.buf = s.buf[:s.pos]
+		case 21: // Ctrl-U
+			s.buf = append([]rune(nil), s.buf[s.pos:]...)
+			s.pos = 0
+		case 23: // Ctrl-W
+			start := s.pos
+			for start > 0 && s.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && s.buf[start-1] != ' ' {
+				start--
+			}
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case 12: // Ctrl-L
+			e.write("\x1b[H\x1b[2J")
+		case 127, 8: // Backspace
+			if s.pos > 0 {
+				s.pos--
+				s.deleteAt(s.pos)
+			}
+		case '\t':
+			e.complete(s)
+		case 16: // Ctrl-P
+			e.historyStep(s, -1)
+		case 14: // Ctrl-N
+			e.historyStep(s, 1)
+		case 27: // escape sequence
+			e.escape(s)
+		default:
+			if r >= 32 {
+				s.buf = append(s.buf[:s.pos], append([]rune{r}, s.buf[s.pos:]...)...)
+				s.pos++
+			}
+		}
+		e.redraw(s)
+	}
+}
+
+// escape handles the arrow, Home, End and Delete key sequences.
+func (e *LineEditor) escape(s *editState) {
+	r, _, err := e.reader.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+	r, _, err = e.reader.ReadRune()
+	if err != nil {
+		return
+	}
+	switch r {
+	case 'A':
+		e.historyStep(s, -1)
+	case 'B':
+		e.historyStep(s, 1)
+	case 'C':
+		s.right()
+	case 'D':
+		s.left()
+	case 'H':
+		s.pos = 0
+	case 'F':
+		s.pos = len(s.buf)
+	case '1', '3', '4', '7', '8':
+		if next, _, _ := e.reader.ReadRune(); next != '~' {
+			return
+		}
+		switch r {
+		case '1', '7':
+			s.pos = 0
+		case '4', '8':
+			s.pos = len(s.buf)
+		case '3':
+			s.deleteAt(s.pos)
+		}
+	}
+}
+
+func (e *LineEditor) historyStep(s *editState, delta int) {
+	next := s.histIdx + delta
+	if next < 0 || next > len(e.history) {
+		return
+	}
+	if s.histIdx == len(e.history) {
+		s.saved = append([]rune(nil), s.buf...)
+	}
+	s.histIdx = next
+	if next == len(e.history) {
+		s.buf = append([]rune(nil), s.saved...)
+	} else {
+		s.buf = []rune(e.history[next])
+	}
+	s.pos = len(s.buf)
+}
+
+// complete replaces the word before the cursor with the single candidate, or
+// with the candidates' common prefix, listing them when that adds nothing.
+func (e *LineEditor) complete(s *editState) {
+	if e.Complete == nil {
+		return
+	}
+	before := string(s.buf[:s.pos])
+	candidates := e.Complete(before)
+	if len(candidates) == 0 {
+		return
+	}
+	start := strings.LastIndex(before, " ") + 1
+	word := before[start:]
+
+	replacement := candidates[0]
+	if len(candidates) == 1 {
+		replacement += " "
+	} else {
+		for _, c := range candidates[1:] {
+			replacement = commonPrefix(replacement, c)
+		}
+	}
+	if len(candidates) > 1 && len([]rune(replacement)) <= len([]rune(word)) {
+		e.write("\n" + strings.Join(candidates, "  ") + "\n")
+		return
+	}
+	rest := s.buf[s.pos:]
+	s.buf = append([]rune(before[:start]+replacement), rest...)
+	s.pos = len([]rune(before[:start] + replacement))
+}
+
+func commonPrefix(a, b string) string {
+	ar, br := []rune(a), []rune(b)
+	n := 0
+	for n < len(ar) && n < len(br) && strings.EqualFold(string(ar[n]), string(br[n])) {
+		n++
+	}
+	return string(ar[:n])
+}
+
+func (e *LineEditor) redraw(s *editState) {
+	line := "\r" + s.prompt + string(s.buf) + "\x1b[K"
+	if back := len(s.buf) - s.pos; back > 0 {
+		line += fmt.Sprintf("\x1b[%dD", back)
+	}
+	fmt.Fprint(e.out, line)
+}
+
+// write prints text, translating newlines for a terminal in raw mode.
+func (e *LineEditor) write(text string) {
+	fmt.Fprint(e.out, strings.ReplaceAll(text, "\n", "\r\n"))
+}
+
+func (s *editState) left() {
+	if s.pos > 0 {
+		s.pos--
+	}
+}
+
+func (s *editState) right() {
+	if s.pos < len(s.buf) {
+		s.pos++
+	}
+}
+
+func (s *editState) deleteAt(i int) {
+	if i < len(s.buf) {
+		s.buf = append(s.buf[:i], s.buf[i+1:]...)
+	}
+}
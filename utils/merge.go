@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+// MergePolicy decides what MergePlans does when one plan adds a subreddit
+// that the other removes.
+type MergePolicy string
+
+const (
+	MergeLatest MergePolicy = "latest" // the later plan wins
+	MergeAsk    MergePolicy = "ask"    // MergeOptions.Resolve decides
+	MergeDrop   MergePolicy = "drop"   // neither change is kept
+)
+
+// MergePolicies lists every valid MergePolicy.
+var MergePolicies = []MergePolicy{MergeLatest, MergeAsk, MergeDrop}
+
+// ParseMergePolicy validates a policy name.
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	for _, p := range MergePolicies {
+		if strings.EqualFold(name, string(p)) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown merge policy %q (use latest, ask or drop)", name)
+}
+
+// DefaultMergePolicy returns the policy from REDDMEIT_MERGE_POLICY, or
+// MergeLatest when it is unset. An invalid value returns MergeLatest along
+// with the error.
+func DefaultMergePolicy() (MergePolicy, error) {
+	name := os.Getenv("REDDMEIT_MERGE_POLICY")
+	if name == "" {
+		return MergeLatest, nil
+	}
+	p, err := ParseMergePolicy(name)
+	if err != nil {
+		return MergeLatest, fmt.Errorf("REDDMEIT_MERGE_POLICY: %w", err)
+	}
+	return p, nil
+}
+
+// MergeConflict is a subreddit one plan adds and the other removes.
+type MergeConflict struct {
+	Subreddit  string `json:"subreddit"`
+	Earlier    string `json:"earlier"`    // "add" or "remove", from the first plan
+	Later      string `json:"later"`      // the second plan's action
+	Resolution string `json:"resolution"` // "add", "remove", or "" when dropped
+}
+
+// MergeOptions configures MergePlans.
+type MergeOptions struct {
+	Policy MergePolicy
+
+	// Resolve picks "add", "remove" or "" (drop) for a conflict under
+	// MergeAsk. Without it MergeAsk behaves like MergeLatest.
+	Resolve func(MergeConflict) string
+
+	// Subreddits on the protected list are never kept in the removal list.
+	Protected *ProtectedList
+}
+
+// MergePlans combines two plans, b being the later one. Subreddits are
+// matched ignoring case and the r/ prefix and kept under the first spelling
+// seen. When one plan adds a subreddit the other removes, opts.Policy
+// decides; every such conflict is returned with how it was resolved. The
+// winning side's explanation, category and source are kept, as is a's
+// conversation (or b's when a has none).
+func MergePlans(a, b models.RecommendationPlan, opts MergeOptions) (models.RecommendationPlan, []MergeConflict) {
+	spelling := map[string]string{} // lowercased name → first spelling
+	canonical := func(sub string) string {
+		if normalized, err := NormalizeSubreddit(sub); err == nil {
+			sub = normalized
+		}
+		key := strings.ToLower(strings.TrimPrefix(sub, "r/"))
+		if first, ok := spelling[key]; ok {
+			return first
+		}
+		spelling[key] = sub
+		return sub
+	}
+
+	// merged holds each subreddit's action and the plan it came from; the
+	// later plan overwrites the earlier one unless the policy says otherwise.
+	type entry struct {
+		action string
+		from   models.RecommendationPlan
+		key    string // spelling in from
+	}
+	merged := map[string]entry{}
+	var order []string
+	var conflicts []MergeConflict
+
+	for _, plan := range []models.RecommendationPlan{a, b} {
+		// A plan that both adds and removes a subreddit says nothing
+		// about it, so neither of its changes is kept.
+		contradicted := map[string]bool{}
+		for _, sub := range plan.ToAdd {
+			if containsSubreddit(plan.ToRemove, sub) {
+				contradicted[canonical(sub)] = true
+			}
+		}
+		for _, list := range []struct {
+			action string
+			subs   []string
+		}{{"add", plan.ToAdd}, {"remove", plan.ToRemove}} {
+			for _, sub := range list.subs {
+				name := canonical(sub)
+				prev, seen := merged[name]
+				if !seen {
+					order = append(order, name)
+				}
+				if contradicted[name] {
+					if !seen {
+						merged[name] = entry{}
+					}
+					continue
+				}
+				next := entry{list.action, plan, sub}
+				// Plans never contradict themselves here, so a different
+				// action already seen came from the earlier plan.
+				if seen && prev.action != "" && prev.action != list.action {
+					conflict := MergeConflict{Subreddit: name, Earlier: prev.action, Later: list.action}
+					conflict.Resolution = resolveConflict(conflict, opts)
+					conflicts = append(conflicts, conflict)
+					switch conflict.Resolution {
+					case prev.action:
+						next = prev
+					case "":
+						next.action = ""
+					}
+				}
+				merged[name] = next
+			}
+		}
+	}
+
+	out := models.RecommendationPlan{
+		ToAdd:             []string{},
+		Explanations:      map[string]string{},
+		Categories:        map[string]string{},
+		Sources:           map[string]string{},
+		RequestConfidence: map[string]float64{},
+		PromptVersion:     b.PromptVersion,
+		Conversation:      a.Conversation,
+	}
+	if out.PromptVersion == "" {
+		out.PromptVersion = a.PromptVersion
+	}
+	if out.Conversation == nil {
+		out.Conversation = b.Conversation
+	}
+	var toRemove []string
+	for _, name := range order {
+		e := merged[name]
+		switch e.action {
+		case "add":
+			out.ToAdd = append(out.ToAdd, name)
+		case "remove":
+			toRemove = append(toRemove, name)
+		default:
+			continue
+		}
+		if v, ok := e.from.Explanations[e.key]; ok {
+			out.Explanations[name] = v
+		}
+		if v, ok := e.from.Categories[e.key]; ok {
+			out.Categories[name] = v
+		}
+		if v, ok := e.from.Sources[e.key]; ok {
+			out.Sources[name] = v
+		}
+		if v, ok := e.from.RequestConfidence[e.key]; ok {
+			out.RequestConfidence[name] = v
+		}
+	}
+	out.ToRemove = opts.Protected.FilterRemovals(toRemove)
+	return out, conflicts
+}
+
+func resolveConflict(c MergeConflict, opts MergeOptions) string {
+	switch opts.Policy {
+	case MergeDrop:
+		return ""
+	case MergeAsk:
+		if opts.Resolve != nil {
+			return opts.Resolve(c)
+		}
+	}
+	return c.Later
+}
+
+// DescribeConflict explains how a merge conflict was resolved.
+func DescribeConflict(c MergeConflict) string {
+	outcome := "dropped"
+	switch c.Resolution {
+	case "add":
+		outcome = "will be added"
+	case "remove":
+		outcome = "will be removed"
+	}
+	return fmt.Sprintf("⚖️  %s: earlier %s, now %s → %s", c.Subreddit, c.Earlier, c.Later, outcome)
+}
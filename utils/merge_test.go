@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+func TestMergePlans(t *testing.T) {
+	earlier := models.RecommendationPlan{
+		ToAdd:        []string{"r/books", "r/news"},
+		ToRemove:     []string{"r/pics"},
+		Explanations: map[string]string{"r/news": "earlier reason", "r/pics": "you never visit"},
+		Categories:   map[string]string{"r/news": "📰 Earlier"},
+	}
+	later := models.RecommendationPlan{
+		ToAdd:        []string{"pics"},
+		ToRemove:     []string{"News"},
+		Explanations: map[string]string{"News": "later reason", "pics": "you asked for photos"},
+		Categories:   map[string]string{"News": "📰 Later"},
+	}
+	keepEarlier := func(c MergeConflict) string { return c.Earlier }
+	chatA := []models.ChatMessage{{Role: "user", Content: "books please"}}
+	chatB := []models.ChatMessage{{Role: "user", Content: "and news"}}
+
+	tests := []struct {
+		name          string
+		a, b          models.RecommendationPlan
+		opts          MergeOptions
+		add, remove   []string
+		explanations  map[string]string
+		categories    map[string]string
+		conversation  []models.ChatMessage
+		conflictCount int
+	}{
+		{
+			name:          "latest keeps the later side and its reasons",
+			a:             earlier,
+			b:             later,
+			opts:          MergeOptions{Policy: MergeLatest},
+			add:           []string{"r/books", "r/pics"},
+			remove:        []string{"r/news"},
+			explanations:  map[string]string{"r/news": "later reason", "r/pics": "you asked for photos"},
+			categories:    map[string]string{"r/news": "📰 Later"},
+			conflictCount: 2,
+		},
+		{
+			name:          "ask uses Resolve and keeps the chosen side's reasons",
+			a:             earlier,
+			b:             later,
+			opts:          MergeOptions{Policy: MergeAsk, Resolve: keepEarlier},
+			add:           []string{"r/books", "r/news"},
+			remove:        []string{"r/pics"},
+			explanations:  map[string]string{"r/news": "earlier reason", "r/pics": "you never visit"},
+			categories:    map[string]string{"r/news": "📰 Earlier"},
+			conflictCount: 2,
+		},
+		{
+			name:          "ask without Resolve behaves like latest",
+			a:             earlier,
+			b:             later,
+			opts:          MergeOptions{Policy: MergeAsk},
+			add:           []string{"r/books", "r/pics"},
+			remove:        []string{"r/news"},
+			explanations:  map[string]string{"r/news": "later reason", "r/pics": "you asked for photos"},
+			categories:    map[string]string{"r/news": "📰 Later"},
+			conflictCount: 2,
+		},
+		{
+			name:          "drop leaves conflicting subreddits out",
+			a:             earlier,
+			b:             later,
+			opts:          MergeOptions{Policy: MergeDrop},
+			add:           []string{"r/books"},
+			explanations:  map[string]string{},
+			categories:    map[string]string{},
+			conflictCount: 2,
+		},
+		{
+			name:         "a plan that adds and removes the same subreddit keeps neither",
+			a:            models.RecommendationPlan{ToAdd: []string{"r/books", "r/pics"}, ToRemove: []string{"Books"}},
+			b:            models.RecommendationPlan{},
+			add:          []string{"r/pics"},
+			explanations: map[string]string{},
+			categories:   map[string]string{},
+		},
+		{
+			name:         "a later self-contradiction leaves the earlier change alone",
+			a:            models.RecommendationPlan{ToAdd: []string{"r/books"}},
+			b:            models.RecommendationPlan{ToAdd: []string{"r/books"}, ToRemove: []string{"r/books"}},
+			add:          []string{"r/books"},
+			explanations: map[string]string{},
+			categories:   map[string]string{},
+		},
+		{
+			name:         "an earlier self-contradiction lets the later plan decide",
+			a:            models.RecommendationPlan{ToAdd: []string{"r/books"}, ToRemove: []string{"r/books"}},
+			b:            models.RecommendationPlan{ToRemove: []string{"books"}},
+			remove:       []string{"r/books"},
+			explanations: map[string]string{},
+			categories:   map[string]string{},
+		},
+		{
+			name:         "the earlier conversation is kept",
+			a:            models.RecommendationPlan{ToAdd: []string{"r/books"}, Conversation: chatA},
+			b:            models.RecommendationPlan{ToAdd: []string{"r/news"}, Conversation: chatB},
+			add:          []string{"r/books", "r/news"},
+			explanations: map[string]string{},
+			categories:   map[string]string{},
+			conversation: chatA,
+		},
+		{
+			name:         "the later conversation is used when the earlier plan has none",
+			a:            models.RecommendationPlan{ToAdd: []string{"r/books"}},
+			b:            models.RecommendationPlan{Conversation: chatB},
+			add:          []string{"r/books"},
+			explanations: map[string]string{},
+			categories:   map[string]string{},
+			conversation: chatB,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := MergePlans(tt.a, tt.b, tt.opts)
+			if len(got.ToAdd) == 0 {
+				got.ToAdd = nil
+			}
+			if !reflect.DeepEqual(got.ToAdd, tt.add) {
+				t.Errorf("ToAdd = %v, want %v", got.ToAdd, tt.add)
+			}
+			if !reflect.DeepEqual(got.ToRemove, tt.remove) {
+				t.Errorf("ToRemove = %v, want %v", got.ToRemove, tt.remove)
+			}
+			if !reflect.DeepEqual(got.Explanations, tt.explanations) {
+				t.Errorf("Explanations = %v, want %v", got.Explanations, tt.explanations)
+			}
+			if !reflect.DeepEqual(got.Categories, tt.categories) {
+				t.Errorf("Categories = %v, want %v", got.Categories, tt.categories)
+			}
+			if !reflect.DeepEqual(got.Conversation, tt.conversation) {
+				t.Errorf("Conversation = %v, want %v", got.Conversation, tt.conversation)
+			}
+			if len(conflicts) != tt.conflictCount {
+				t.Errorf("got %d conflicts %v, want %d", len(conflicts), conflicts, tt.conflictCount)
+			}
+		})
+	}
+}
+
+func TestMergePlansConflictDetails(t *testing.T) {
+	a := models.RecommendationPlan{ToAdd: []string{"r/news"}}
+	b := models.RecommendationPlan{ToRemove: []string{"r/News"}}
+	var asked []MergeConflict
+	_, conflicts := MergePlans(a, b, MergeOptions{
+		Policy:  MergeAsk,
+		Resolve: func(c MergeConflict) string { asked = append(asked, c); return "" },
+	})
+	want := []MergeConflict{{Subreddit: "r/news", Earlier: "add", Later: "remove"}}
+	if !reflect.DeepEqual(asked, want) {
+		t.Errorf("Resolve was asked %v, want %v", asked, want)
+	}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", conflicts, want)
+	}
+}
+
+func TestDefaultMergePolicy(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    MergePolicy
+		wantErr bool
+	}{
+		{"", MergeLatest, false},
+		{"drop", MergeDrop, false},
+		{"ASK", MergeAsk, false},
+		{"sometimes", MergeLatest, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("REDDMEIT_MERGE_POLICY", tt.env)
+		got, err := DefaultMergePolicy()
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("REDDMEIT_MERGE_POLICY=%q: got %q, %v; want %q, error %v", tt.env, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
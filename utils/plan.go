@@ -1,127 +1,161 @@
 package utils
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
-	"sort"
 	"strings"
-	"time"
 
 	"github.com/HenryArin/ReddmeitAlpha/models"
 )
 
-// PrintPlan prints the recommended subreddits with optional explanations.
+// PrintPlan prints the recommended subreddits with optional explanations,
+// in color when stdout is a terminal.
 func PrintPlan(plan models.RecommendationPlan) {
-	sort.Strings(plan.ToAdd)
-	sort.Strings(plan.ToRemove)
-
-	if len(plan.ToAdd) > 0 {
-		fmt.Println("To Add:")
-		for _, sub := range plan.ToAdd {
-			if explanation, ok := plan.Explanations[sub]; ok && explanation != "" {
-				fmt.Printf(" + %s (%s)\n", sub, explanation)
-			} else {
-				fmt.Printf(" + %s\n", sub)
+	StdoutRenderer().Render(os.Stdout, PlanReport{Plan: plan})
+}
+
+// ValidatePlan checks every subreddit name in plan and returns the plan with
+// names in r/name form and duplicates dropped. A subreddit may not be both
+// added and removed.
+func ValidatePlan(plan models.RecommendationPlan) (models.RecommendationPlan, error) {
+	var invalid []string
+	normalize := func(list []string) []string {
+		var out []string
+		for _, name := range list {
+			sub, err := NormalizeSubreddit(name)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("%q", name))
+				continue
 			}
-		}
-	}
-	if len(plan.ToRemove) > 0 {
-		fmt.Println("To Remove:")
-		for _, sub := range plan.ToRemove {
-			if explanation, ok := plan.Explanations[sub]; ok && explanation != "" {
-				fmt.Printf(" - %s (%s)\n", sub, explanation)
-			} else {
-				fmt.Printf(" - %s\n", sub)
+			if !containsSubreddit(out, sub) {
+				out = append(out, sub)
 			}
 		}
+		return out
 	}
-	if len(plan.ToAdd) == 0 && len(plan.ToRemove) == 0 {
-		fmt.Println("= No changes needed.")
-	}
-}
-
-// SavePlanToFile saves the plan as a JSON file in the /logs directory.
-func SavePlanToFile(plan models.RecommendationPlan, prompt string) {
-	sort.Strings(plan.ToAdd)
-	sort.Strings(plan.ToRemove)
-
-	timestamp := time.Now().Format("2006-01-02")
-	safePrompt := strings.ReplaceAll(prompt, " ", "_")
-	safePrompt = strings.ReplaceAll(safePrompt, "/", "_")
-	filename := fmt.Sprintf("logs/%s_%s.json", timestamp, safePrompt)
-
-	file, err := os.Create(filename)
-	if err != nil {
-		fmt.Printf("❌ Failed to save plan: %v\n", err)
-		return
+	out := ClonePlan(plan)
+	out.ToAdd = normalize(plan.ToAdd)
+	out.ToRemove = normalize(plan.ToRemove)
+	if len(invalid) > 0 {
+		return plan, fmt.Errorf("invalid subreddit names: %s", strings.Join(invalid, ", "))
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(plan); err != nil {
-		fmt.Printf("❌ Failed to encode plan: %v\n", err)
-		return
+	for _, sub := range out.ToAdd {
+		if containsSubreddit(out.ToRemove, sub) {
+			return plan, fmt.Errorf("%s is both added and removed", sub)
+		}
 	}
 
-	fmt.Printf("✅ Saved to: %s\n", filename)
+	// Re-key per-subreddit details to the normalized names.
+	rekey(out.Explanations)
+	rekey(out.Categories)
+	rekey(out.Sources)
+	rekey(out.RequestConfidence)
+	return out, nil
 }
 
-// MergePlans combines two plans and merges explanations.
-func MergePlans(a, b models.RecommendationPlan) models.RecommendationPlan {
-	toAdd := map[string]bool{}
-	toRemove := map[string]bool{}
-	explanations := map[string]string{}
+// DiffPlan sorts a plan's changes into the ones that still apply to the
+// current subscriptions and the stale ones that already happened.
+func DiffPlan(plan models.RecommendationPlan, subscribed map[string]bool) models.PlanDiff {
+	current := make(map[string]bool, len(subscribed))
+	for name := range subscribed {
+		current[strings.ToLower(name)] = true
+	}
+	isSubscribed := func(sub string) bool {
+		return current[strings.ToLower(strings.TrimPrefix(sub, "r/"))]
+	}
 
-	for _, sub := range a.ToAdd {
-		toAdd[sub] = true
+	diff := models.PlanDiff{
+		ToAdd:             []string{},
+		ToRemove:          []string{},
+		AlreadySubscribed: []string{},
+		NotSubscribed:     []string{},
+	}
+	for _, sub := range plan.ToAdd {
+		if isSubscribed(sub) {
+			diff.AlreadySubscribed = append(diff.AlreadySubscribed, sub)
+		} else {
+			diff.ToAdd = append(diff.ToAdd, sub)
+		}
 	}
-	for _, sub := range a.ToRemove {
-		toRemove[sub] = true
+	for _, sub := range plan.ToRemove {
+		if isSubscribed(sub) {
+			diff.ToRemove = append(diff.ToRemove, sub)
+		} else {
+			diff.NotSubscribed = append(diff.NotSubscribed, sub)
+		}
 	}
-	for _, sub := range b.ToAdd {
-		toAdd[sub] = true
+	return diff
+}
+
+// PrintPlanDiff prints what DiffPlan found, pointing out stale changes.
+func PrintPlanDiff(diff models.PlanDiff) {
+	PrintPlan(models.RecommendationPlan{ToAdd: diff.ToAdd, ToRemove: diff.ToRemove})
+	if len(diff.AlreadySubscribed) > 0 {
+		fmt.Printf("⏭️  Already subscribed (stale): %s\n", strings.Join(diff.AlreadySubscribed, ", "))
 	}
-	for _, sub := range b.ToRemove {
-		toRemove[sub] = true
+	if len(diff.NotSubscribed) > 0 {
+		fmt.Printf("⏭️  Already unsubscribed (stale): %s\n", strings.Join(diff.NotSubscribed, ", "))
 	}
+}
 
-	for _, m := range []map[string]string{a.Explanations, b.Explanations} {
-		for sub, reason := range m {
-			explanations[sub] = reason
+// DropStale returns plan without the changes diff found stale.
+func DropStale(plan models.RecommendationPlan, diff models.PlanDiff) models.RecommendationPlan {
+	out := ClonePlan(plan)
+	out.ToAdd = append([]string(nil), diff.ToAdd...)
+	out.ToRemove = append([]string(nil), diff.ToRemove...)
+	return out
+}
+
+func rekey[V any](m map[string]V) {
+	for name, v := range m {
+		if sub, err := NormalizeSubreddit(name); err == nil && sub != name {
+			delete(m, name)
+			m[sub] = v
 		}
 	}
+}
 
-	// Avoid conflicts: a sub can't be in both lists
-	for sub := range toAdd {
-		if toRemove[sub] {
-			delete(toAdd, sub)
-			delete(toRemove, sub)
-			delete(explanations, sub)
+func containsSubreddit(list []string, sub string) bool {
+	for _, s := range list {
+		if SameSubreddit(s, sub) {
+			return true
 		}
 	}
+	return false
+}
 
-	return models.RecommendationPlan{
-		ToAdd:        keys(toAdd),
-		ToRemove:     keys(toRemove),
-		Explanations: explanations,
-	}
+// ClonePlan returns a deep copy of plan so it can be kept as an undo snapshot.
+func ClonePlan(plan models.RecommendationPlan) models.RecommendationPlan {
+	clone := plan
+	clone.ToAdd = append([]string(nil), plan.ToAdd...)
+	clone.ToRemove = append([]string(nil), plan.ToRemove...)
+	clone.Conversation = append([]models.ChatMessage(nil), plan.Conversation...)
+	clone.Explanations = cloneMap(plan.Explanations)
+	clone.Categories = cloneMap(plan.Categories)
+	clone.Sources = cloneMap(plan.Sources)
+	clone.RequestConfidence = cloneMap(plan.RequestConfidence)
+	return clone
 }
 
-func keys(m map[string]bool) []string {
-	out := []string{}
-	for k := range m {
-		out = append(out, k)
+func cloneMap[V any](m map[string]V) map[string]V {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]V, len(m))
+	for k, v := range m {
+		out[k] = v
 	}
 	return out
 }
 
-// ParseSubredditPlan parses a GPT reply into a plan with explanations.
+// ParseSubredditPlan parses a GPT reply into a plan with explanations and
+// the category headers ("🥐 Baking:") the subreddits were grouped under.
 func ParseSubredditPlan(response string) models.RecommendationPlan {
 	var toAdd, toRemove []string
 	explanations := map[string]string{}
+	categories := map[string]string{}
+	category := ""
 
 	lines := strings.Split(response, "\n")
 	for _, line := range lines {
@@ -132,13 +166,21 @@ func ParseSubredditPlan(response string) models.RecommendationPlan {
 			if sub != "" {
 				toAdd = append(toAdd, sub)
 				explanations[sub] = extractExplanation(line)
+				if category != "" {
+					categories[sub] = category
+				}
 			}
 		} else if strings.HasPrefix(line, "- r/") || strings.HasPrefix(line, "-r/") {
 			sub := extractSubreddit(line)
 			if sub != "" {
 				toRemove = append(toRemove, sub)
 				explanations[sub] = extractExplanation(line)
+				if category != "" {
+					categories[sub] = category
+				}
 			}
+		} else if header := extractCategory(line); header != "" {
+			category = header
 		}
 	}
 
@@ -146,7 +188,26 @@ func ParseSubredditPlan(response string) models.RecommendationPlan {
 		ToAdd:        toAdd,
 		ToRemove:     toRemove,
 		Explanations: explanations,
+		Categories:   categories,
+	}
+}
+
+// extractCategory returns the heading text of a category line such as
+// "🥐 Baking:", "**Fitness:**" or "### Gaming", or "" for other lines.
+func extractCategory(line string) string {
+	if strings.HasPrefix(line, "=") || strings.Contains(line, "r/") {
+		return ""
+	}
+	isHeading := strings.HasPrefix(line, "#")
+	trimmed := strings.TrimRight(line, "*_ ")
+	if !isHeading && !strings.HasSuffix(trimmed, ":") {
+		return ""
+	}
+	header := strings.Trim(trimmed, "#*_: ")
+	if header == "" || len(header) > 40 {
+		return ""
 	}
+	return header
 }
 
 // extractSubreddit uses regex to find the r/subreddit pattern.
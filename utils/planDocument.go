@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+// PlanDir returns the directory plans are saved in. REDDMEIT_PLAN_DIR
+// overrides the default, logs/ in the working directory.
+func PlanDir() string {
+	if dir := os.Getenv("REDDMEIT_PLAN_DIR"); dir != "" {
+		return dir
+	}
+	return "logs"
+}
+
+// PlanMeta describes where a plan came from.
+type PlanMeta struct {
+	Account      string
+	Prompts      []string
+	Model        string
+	Conversation []models.ChatMessage
+}
+
+// NewPlanDocument wraps plan in the current file format.
+func NewPlanDocument(plan models.RecommendationPlan, meta PlanMeta) models.PlanDocument {
+	doc := models.PlanDocument{
+		Schema:        models.PlanSchemaVersion,
+		CreatedAt:     time.Now(),
+		Account:       meta.Account,
+		Prompts:       meta.Prompts,
+		Model:         meta.Model,
+		PromptVersion: plan.PromptVersion,
+		Items:         []models.PlanItem{},
+		Conversation:  meta.Conversation,
+	}
+	if doc.Conversation == nil {
+		doc.Conversation = plan.Conversation
+	}
+	item := func(sub, action string) models.PlanItem {
+		return models.PlanItem{
+			Subreddit:         sub,
+			Action:            action,
+			Category:          plan.Categories[sub],
+			Reason:            plan.Explanations[sub],
+			RequestConfidence: plan.RequestConfidence[sub],
+			Source:            plan.Sources[sub],
+		}
+	}
+	for _, sub := range plan.ToAdd {
+		doc.Items = append(doc.Items, item(sub, "add"))
+	}
+	for _, sub := range plan.ToRemove {
+		doc.Items = append(doc.Items, item(sub, "remove"))
+	}
+	sort.SliceStable(doc.Items, func(i, j int) bool {
+		a, b := doc.Items[i], doc.Items[j]
+		if a.Action != b.Action {
+			return a.Action == "add"
+		}
+		return strings.ToLower(a.Subreddit) < strings.ToLower(b.Subreddit)
+	})
+	doc.Hash = PlanHash(doc.Items)
+	return doc
+}
+
+// PlanHash returns the content hash of a plan's items.
+func PlanHash(items []models.PlanItem) string {
+	data, _ := json.Marshal(items)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// PlanFromDocument returns the plan a document describes.
+func PlanFromDocument(doc models.PlanDocument) models.RecommendationPlan {
+	plan := models.RecommendationPlan{
+		PromptVersion:     doc.PromptVersion,
+		Conversation:      doc.Conversation,
+		Explanations:      map[string]string{},
+		Categories:        map[string]string{},
+		Sources:           map[string]string{},
+		RequestConfidence: map[string]float64{},
+	}
+	for _, it := range doc.Items {
+		if it.Action == "remove" {
+			plan.ToRemove = append(plan.ToRemove, it.Subreddit)
+		} else {
+			plan.ToAdd = append(plan.ToAdd, it.Subreddit)
+		}
+		if it.Reason != "" {
+			plan.Explanations[it.Subreddit] = it.Reason
+		}
+		if it.Category != "" {
+			plan.Categories[it.Subreddit] = it.Category
+		}
+		if it.Source != "" {
+			plan.Sources[it.Subreddit] = it.Source
+		}
+		if it.RequestConfidence != 0 {
+			plan.RequestConfidence[it.Subreddit] = it.RequestConfidence
+		}
+	}
+	return plan
+}
+
+var unsafeLabelChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// SavePlanDocument writes doc into PlanDir under a name made from the time,
+// label and hash, never overwriting an existing file, and returns the path.
+func SavePlanDocument(doc models.PlanDocument, label string) (string, error) {
+	dir := PlanDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+
+	label = strings.Trim(unsafeLabelChars.ReplaceAllString(label, "_"), "_")
+	if label == "" {
+		label = "plan"
+	}
+	base := fmt.Sprintf("%s_%s_%s", doc.CreatedAt.Format("2006-01-02T150405"), label,
+		strings.TrimPrefix(doc.Hash, "sha256:")[:8])
+	for n := 1; ; n++ {
+		name := base + ".json"
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d.json", base, n)
+		}
+		path := filepath.Join(dir, name)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return "", err
+		}
+		return path, f.Close()
+	}
+}
+
+// WritePlanDocument writes doc to filename, replacing it.
+func WritePlanDocument(doc models.PlanDocument, filename string) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+// LoadPlanDocument reads a saved plan. Files written before plans were
+// versioned are upgraded. Unknown fields are rejected so that a file that
+// isn't a plan isn't mistaken for an empty one, a hash that doesn't match
+// the items (the file was edited) is reported, and subreddit names are
+// checked with ValidatePlan.
+func LoadPlanDocument(filename string) (models.PlanDocument, error) {
+	var doc models.PlanDocument
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return doc, err
+	}
+	var probe struct {
+		Schema int `json:"schema"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return doc, fmt.Errorf("%s: not a valid plan: %w", filename, err)
+	}
+
+	switch {
+	case probe.Schema == 0:
+		var plan models.RecommendationPlan
+		if err := decodeStrict(data, &plan); err != nil {
+			return doc, fmt.Errorf("%s: not a valid plan: %w", filename, err)
+		}
+		doc = NewPlanDocument(plan, PlanMeta{})
+		if info, err := os.Stat(filename); err == nil {
+			doc.CreatedAt = info.ModTime()
+		}
+	case probe.Schema > models.PlanSchemaVersion:
+		return doc, fmt.Errorf("%s: plan schema %d is newer than this version of reddmeit supports (%d)",
+			filename, probe.Schema, models.PlanSchemaVersion)
+	default:
+		if err := decodeStrict(data, &doc); err != nil {
+			return doc, fmt.Errorf("%s: not a valid plan: %w", filename, err)
+		}
+		for _, it := range doc.Items {
+			if it.Action != "add" && it.Action != "remove" {
+				return doc, fmt.Errorf("%s: %s has unknown action %q", filename, it.Subreddit, it.Action)
+			}
+		}
+		if doc.Hash != "" && doc.Hash != PlanHash(doc.Items) {
+			fmt.Printf("⚠️  %s was edited after it was saved (content hash mismatch).\n", filename)
+		}
+	}
+
+	// Validate the names and rebuild the items in normalized form.
+	plan, err := ValidatePlan(PlanFromDocument(doc))
+	if err != nil {
+		return doc, fmt.Errorf("%s: %w", filename, err)
+	}
+	normalized := NewPlanDocument(plan, PlanMeta{})
+	doc.Items, doc.Hash = normalized.Items, normalized.Hash
+	return doc, nil
+}
+
+// SavedPlan summarizes a plan file in PlanDir.
+type SavedPlan struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Account   string    `json:"account,omitempty"`
+	Adds      int       `json:"adds"`
+	Removes   int       `json:"removes"`
+}
+
+// ListPlanDocuments lists the plans saved in PlanDir, newest first. Files
+// that aren't valid plans are skipped.
+func ListPlanDocuments() ([]SavedPlan, error) {
+	paths, err := filepath.Glob(filepath.Join(PlanDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	plans := []SavedPlan{}
+	for _, path := range paths {
+		doc, err := LoadPlanDocument(path)
+		if err != nil {
+			continue
+		}
+		saved := SavedPlan{Name: filepath.Base(path), CreatedAt: doc.CreatedAt, Account: doc.Account}
+		for _, it := range doc.Items {
+			if it.Action == "add" {
+				saved.Adds++
+			} else {
+				saved.Removes++
+			}
+		}
+		plans = append(plans, saved)
+	}
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].CreatedAt.After(plans[j].CreatedAt) })
+	return plans, nil
+}
+
+// LoadPlanFromFile reads a saved plan, validated as by LoadPlanDocument.
+func LoadPlanFromFile(filename string) (models.RecommendationPlan, error) {
+	doc, err := LoadPlanDocument(filename)
+	if err != nil {
+		return models.RecommendationPlan{}, err
+	}
+	return PlanFromDocument(doc), nil
+}
+
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
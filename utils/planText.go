@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+const planTextHeader = `# Reddmeit plan. Edit it, then save and close the editor.
+#
+#   + r/name   subscribe
+#   - r/name   unsubscribe
+#
+# Delete a line to drop that change, or flip its sign. Text after "#" is a
+# comment; on a change line it is kept as the reason. "## Heading" lines
+# group the changes below them into a category.
+`
+
+// FormatPlanText writes plan in the text format read by ParsePlanText:
+// changes grouped under "## Category" headings, additions first, with
+// explanations as trailing comments.
+func FormatPlanText(plan models.RecommendationPlan) string {
+	type line struct{ sign, sub string }
+	groups := map[string][]line{}
+	for _, sub := range plan.ToAdd {
+		groups[plan.Categories[sub]] = append(groups[plan.Categories[sub]], line{"+", sub})
+	}
+	for _, sub := range plan.ToRemove {
+		groups[plan.Categories[sub]] = append(groups[plan.Categories[sub]], line{"-", sub})
+	}
+
+	var categories []string
+	for category := range groups {
+		if category != "" {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	if _, ok := groups[""]; ok {
+		categories = append(categories, "")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(planTextHeader)
+	for _, category := range categories {
+		lines := groups[category]
+		sort.SliceStable(lines, func(i, j int) bool {
+			if lines[i].sign != lines[j].sign {
+				return lines[i].sign == "+"
+			}
+			return strings.ToLower(lines[i].sub) < strings.ToLower(lines[j].sub)
+		})
+		if category != "" {
+			fmt.Fprintf(&sb, "\n## %s\n", category)
+		} else if len(categories) > 1 {
+			sb.WriteString("\n## Other\n")
+		} else {
+			sb.WriteString("\n")
+		}
+		for _, l := range lines {
+			// Reasons must stay on their change's line.
+			if reason := strings.Join(strings.Fields(plan.Explanations[l.sub]), " "); reason != "" {
+				fmt.Fprintf(&sb, "%s %-24s # %s\n", l.sign, l.sub, reason)
+			} else {
+				fmt.Fprintf(&sb, "%s %s\n", l.sign, l.sub)
+			}
+		}
+	}
+	if len(plan.ToAdd) == 0 && len(plan.ToRemove) == 0 {
+		sb.WriteString("\n# The plan is empty. Add lines like \"+ r/books\".\n")
+	}
+	return sb.String()
+}
+
+// ParsePlanText reads the format written by FormatPlanText. Sources and
+// confidence are kept from base for changes that were already in it; new
+// or flipped changes are recorded as the user's. Every problem is reported
+// with its line number.
+func ParsePlanText(text string, base models.RecommendationPlan) (models.RecommendationPlan, error) {
+	plan := models.RecommendationPlan{
+		Explanations:      map[string]string{},
+		Categories:        map[string]string{},
+		Sources:           map[string]string{},
+		RequestConfidence: map[string]float64{},
+		PromptVersion:     base.PromptVersion,
+	}
+	var problems []string
+	category := ""
+
+	for i, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(raw)
+		if strings.HasPrefix(line, "## ") {
+			category = strings.TrimSpace(strings.TrimPrefix(line, "## "))
+			if category == "Other" {
+				category = ""
+			}
+			continue
+		}
+		content, comment := line, ""
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			content, comment = strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+		}
+		if content == "" {
+			continue
+		}
+
+		sign, name := content[:1], strings.TrimSpace(content[1:])
+		if sign != "+" && sign != "-" {
+			problems = append(problems, fmt.Sprintf("line %d: start with + or -: %q", i+1, content))
+			continue
+		}
+		sub, err := NormalizeSubreddit(name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", i+1, err))
+			continue
+		}
+		if containsSubreddit(plan.ToAdd, sub) || containsSubreddit(plan.ToRemove, sub) {
+			problems = append(problems, fmt.Sprintf("line %d: %s is listed twice", i+1, sub))
+			continue
+		}
+
+		wasAdd, wasRemove := containsSubreddit(base.ToAdd, sub), containsSubreddit(base.ToRemove, sub)
+		unchanged := (sign == "+" && wasAdd) || (sign == "-" && wasRemove)
+		if sign == "+" {
+			plan.ToAdd = append(plan.ToAdd, sub)
+		} else {
+			plan.ToRemove = append(plan.ToRemove, sub)
+		}
+		if comment != "" {
+			plan.Explanations[sub] = comment
+		}
+		if category != "" {
+			plan.Categories[sub] = category
+		}
+		if key := baseKey(base, sub); unchanged && base.Sources[key] != "" {
+			plan.Sources[sub] = base.Sources[key]
+			plan.RequestConfidence[sub] = base.RequestConfidence[key]
+		} else if !unchanged {
+			plan.Sources[sub] = "user"
+			plan.RequestConfidence[sub] = 1
+		}
+	}
+
+	if len(problems) > 0 {
+		return plan, fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return plan, nil
+}
+
+// baseKey returns how sub is spelled in base's lists, so its details can
+// be looked up.
+func baseKey(base models.RecommendationPlan, sub string) string {
+	for _, list := range [][]string{base.ToAdd, base.ToRemove} {
+		for _, s := range list {
+			if SameSubreddit(s, sub) {
+				return s
+			}
+		}
+	}
+	return sub
+}
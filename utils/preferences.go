@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+// PreferencesFile returns where the preference profile is stored.
+// REDDMEIT_PREFERENCES_FILE overrides the default.
+func PreferencesFile() string {
+	if file := os.Getenv("REDDMEIT_PREFERENCES_FILE"); file != "" {
+		return file
+	}
+	return filepath.Join(ConfigDir(), "preferences.json")
+}
+
+// LoadPreferences reads the preference profile. A missing file is an empty
+// profile.
+func LoadPreferences() (models.Preferences, error) {
+	prefs := models.Preferences{}
+	data, err := os.ReadFile(PreferencesFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return prefs, nil
+	}
+	if err != nil {
+		return prefs, err
+	}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return prefs, fmt.Errorf("%s: %w", PreferencesFile(), err)
+	}
+	return prefs, nil
+}
+
+// SavePreferences writes the preference profile.
+func SavePreferences(prefs models.Preferences) error {
+	data, err := json.MarshalIndent(prefs, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := PreferencesFile()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+// AddPreference appends value to list unless it is already there (ignoring
+// case) and reports whether it was added.
+func AddPreference(list *[]string, value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false
+	}
+	for _, v := range *list {
+		if strings.EqualFold(v, value) {
+			return false
+		}
+	}
+	*list = append(*list, value)
+	return true
+}
+
+// RemovePreference deletes value from list (ignoring case) and reports
+// whether it was there.
+func RemovePreference(list *[]string, value string) bool {
+	for i, v := range *list {
+		if strings.EqualFold(v, strings.TrimSpace(value)) {
+			*list = append((*list)[:i], (*list)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// IsBlocked reports whether prefs rule out suggesting sub, either by name or
+// because its name is about a blocked topic (see MatchesTopic).
+func IsBlocked(prefs models.Preferences, sub string) bool {
+	for _, blocked := range prefs.BlockedSubs {
+		if SameSubreddit(blocked, sub) {
+			return true
+		}
+	}
+	for _, topic := range prefs.BlockedTopics {
+		if MatchesTopic(sub, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesTopic reports whether the words of sub's name include topic. Names
+// are split into words at underscores, digits and lower-to-upper case
+// changes, so "art" matches r/art, r/ArtHistory and r/pixel_art but not
+// r/smartphones or r/startups. A multi-word topic matches those words in a
+// row or run together, so "board games" matches r/BoardGames and
+// r/boardgames.
+func MatchesTopic(sub, topic string) bool {
+	target := strings.Join(strings.Fields(strings.ToLower(topic)), "")
+	if target == "" {
+		return false
+	}
+	words := nameWords(strings.TrimPrefix(sub, "r/"))
+	for i := range words {
+		joined := ""
+		for _, w := range words[i:] {
+			joined += w
+			if joined == target {
+				return true
+			}
+			if len(joined) >= len(target) {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// nameWords splits a subreddit name into lowercase words.
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = nil
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]):
+			// "ArtHistory" → Art, History
+			flush()
+		case unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && i > 0 && unicode.IsUpper(runes[i-1]):
+			// "NBAMemes" → NBA, Memes
+			flush()
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+func TestMatchesTopic(t *testing.T) {
+	tests := []struct {
+		sub, topic string
+		want       bool
+	}{
+		{"r/art", "art", true},
+		{"r/ArtHistory", "art", true},
+		{"r/pixel_art", "art", true},
+		{"r/Art", "ART", true},
+		{"r/smartphones", "art", false},
+		{"r/startups", "art", false},
+		{"r/AnimeSketch", "anime", true},
+		{"r/NBAMemes", "nba", true},
+		{"r/NBAMemes", "memes", true},
+		{"r/BoardGames", "board games", true},
+		{"r/boardgames", "board games", true},
+		{"r/BoardGameDeals", "board games", false},
+		{"r/news", "", false},
+	}
+	for _, tt := range tests {
+		if got := MatchesTopic(tt.sub, tt.topic); got != tt.want {
+			t.Errorf("MatchesTopic(%q, %q) = %v, want %v", tt.sub, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestIsBlocked(t *testing.T) {
+	prefs := models.Preferences{BlockedSubs: []string{"r/News"}, BlockedTopics: []string{"crypto"}}
+	tests := []struct {
+		sub  string
+		want bool
+	}{
+		{"r/news", true},
+		{"r/CryptoCurrency", true},
+		{"r/crypto_markets", true},
+		{"r/cryptography", false},
+		{"r/books", false},
+	}
+	for _, tt := range tests {
+		if got := IsBlocked(prefs, tt.sub); got != tt.want {
+			t.Errorf("IsBlocked(%q) = %v, want %v", tt.sub, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProtectedList is the set of subreddits no plan may unsubscribe from. It is
+// stored in protected.json in the config directory; names listed in
+// REDDMEIT_PROTECTED (comma-separated) are protected as well but can only be
+// changed in the environment.
+type ProtectedList struct {
+	path    string
+	names   map[string]string // lowercased name → r/Name
+	fromEnv map[string]bool
+	loadErr error // why the file couldn't be read; saving would lose it
+}
+
+// ProtectedFile returns where the protected list is stored.
+// REDDMEIT_PROTECTED_FILE overrides the default.
+func ProtectedFile() string {
+	if file := os.Getenv("REDDMEIT_PROTECTED_FILE"); file != "" {
+		return file
+	}
+	return filepath.Join(ConfigDir(), "protected.json")
+}
+
+// LoadProtected reads the protected list from ProtectedFile and the
+// environment. A missing file is an empty list. If the file can't be read
+// the error is returned along with a list that still holds the names from
+// the environment, and that list refuses to be saved so the file isn't
+// overwritten.
+func LoadProtected() (*ProtectedList, error) {
+	p := &ProtectedList{
+		path:    ProtectedFile(),
+		names:   make(map[string]string),
+		fromEnv: make(map[string]bool),
+	}
+
+	for _, name := range strings.Split(os.Getenv("REDDMEIT_PROTECTED"), ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		sub, err := NormalizeSubreddit(name)
+		if err != nil {
+			return p, fmt.Errorf("REDDMEIT_PROTECTED: %w", err)
+		}
+		p.names[protectedKey(sub)] = sub
+		p.fromEnv[protectedKey(sub)] = true
+	}
+
+	data, err := os.ReadFile(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		p.loadErr = err
+		return p, err
+	}
+	var stored struct {
+		Subreddits []string `json:"subreddits"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		p.loadErr = fmt.Errorf("%s: %w", p.path, err)
+		return p, p.loadErr
+	}
+	for _, name := range stored.Subreddits {
+		if sub, err := NormalizeSubreddit(name); err == nil {
+			p.names[protectedKey(sub)] = sub
+		}
+	}
+	return p, nil
+}
+
+// Contains reports whether sub is protected. A nil list protects nothing.
+func (p *ProtectedList) Contains(sub string) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.names[protectedKey(sub)]
+	return ok
+}
+
+// Names returns the protected subreddits in r/name form, sorted.
+func (p *ProtectedList) Names() []string {
+	if p == nil {
+		return nil
+	}
+	var out []string
+	for _, sub := range p.names {
+		out = append(out, sub)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i]) < strings.ToLower(out[j]) })
+	return out
+}
+
+// Add protects sub and saves the list.
+func (p *ProtectedList) Add(sub string) error {
+	normalized, err := NormalizeSubreddit(sub)
+	if err != nil {
+		return err
+	}
+	p.names[protectedKey(normalized)] = normalized
+	return p.save()
+}
+
+// Remove unprotects sub and saves the list.
+func (p *ProtectedList) Remove(sub string) error {
+	key := protectedKey(sub)
+	if p.fromEnv[key] {
+		return fmt.Errorf("%s is protected by REDDMEIT_PROTECTED; change it there", p.names[key])
+	}
+	if _, ok := p.names[key]; !ok {
+		return fmt.Errorf("%s is not protected", sub)
+	}
+	delete(p.names, key)
+	return p.save()
+}
+
+// FilterRemovals drops protected subreddits from toRemove, printing why.
+func (p *ProtectedList) FilterRemovals(toRemove []string) []string {
+	if p == nil {
+		return toRemove
+	}
+	var kept []string
+	for _, sub := range toRemove {
+		if p.Contains(sub) {
+			fmt.Printf("🛡️  Keeping %s: it is on your protected list.\n", sub)
+			continue
+		}
+		kept = append(kept, sub)
+	}
+	return kept
+}
+
+// save writes the list, leaving out names that only come from the
+// environment.
+func (p *ProtectedList) save() error {
+	if p.loadErr != nil {
+		return fmt.Errorf("not saving the protected list because it couldn't be read (%v); fix or remove the file first", p.loadErr)
+	}
+	var stored struct {
+		Subreddits []string `json:"subreddits"`
+	}
+	stored.Subreddits = []string{}
+	for _, sub := range p.Names() {
+		if !p.fromEnv[protectedKey(sub)] {
+			stored.Subreddits = append(stored.Subreddits, sub)
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p.path, data, 0o644)
+}
+
+func protectedKey(sub string) string {
+	return strings.ToLower(strings.TrimPrefix(sub, "r/"))
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProtectedCorruptFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "protected.json")
+	corrupt := []byte(`{"subreddits": ["r/books",`)
+	if err := os.WriteFile(file, corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REDDMEIT_PROTECTED_FILE", file)
+	t.Setenv("REDDMEIT_PROTECTED", "r/AskHistorians")
+
+	p, err := LoadProtected()
+	if err == nil {
+		t.Fatal("LoadProtected succeeded on a corrupt file")
+	}
+	if !p.Contains("r/AskHistorians") {
+		t.Error("entries from REDDMEIT_PROTECTED were dropped")
+	}
+	if err := p.Add("r/news"); err == nil {
+		t.Error("Add saved over a protected list that couldn't be read")
+	}
+	if data, _ := os.ReadFile(file); string(data) != string(corrupt) {
+		t.Errorf("protected file was rewritten: %s", data)
+	}
+}
+
+func TestLoadProtectedMissingFile(t *testing.T) {
+	t.Setenv("REDDMEIT_PROTECTED_FILE", filepath.Join(t.TempDir(), "protected.json"))
+	t.Setenv("REDDMEIT_PROTECTED", "")
+
+	p, err := LoadProtected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add("books"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadProtected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Contains("r/books") {
+		t.Errorf("saved list = %v, want r/books", again.Names())
+	}
+}
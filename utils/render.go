@@ -0,0 +1,435 @@
+package utils
+
+import (
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+	"golang.org/x/term"
+)
+
+//go:embed templates/report.html
+var reportTemplates embed.FS
+
+// Output formats understood by NewRenderer.
+const (
+	FormatTerminal = "terminal" // color and emoji
+	FormatText     = "text"     // plain text, as PrintPlan writes when piped
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatCSV      = "csv"
+	FormatJSON     = "json"
+)
+
+// Formats lists every output format.
+var Formats = []string{FormatTerminal, FormatText, FormatMarkdown, FormatHTML, FormatCSV, FormatJSON}
+
+var formatAliases = map[string]string{
+	"term": FormatTerminal,
+	"txt":  FormatText,
+	"md":   FormatMarkdown,
+	"htm":  FormatHTML,
+}
+
+// ParseFormat validates a format name, accepting short forms such as "md".
+func ParseFormat(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := formatAliases[name]; ok {
+		name = alias
+	}
+	for _, f := range Formats {
+		if name == f {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q (use %s)", name, strings.Join(Formats, ", "))
+}
+
+// FormatForFile guesses the format from a file name's extension, or returns
+// "" if it doesn't say.
+func FormatForFile(filename string) string {
+	format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if err != nil || format == FormatTerminal {
+		return ""
+	}
+	return format
+}
+
+// PlanReport is what a Renderer writes: a plan, where it came from and what
+// is known about its subreddits.
+type PlanReport struct {
+	Title   string
+	Plan    models.RecommendationPlan
+	Meta    models.PlanDocument // provenance for the header; its Items are ignored
+	Members map[string]int      // subscriber counts, when they were looked up
+}
+
+// ReportItem is one change in a PlanReport, flattened for output.
+type ReportItem struct {
+	Action            string  `json:"action"`
+	Subreddit         string  `json:"subreddit"`
+	Category          string  `json:"category,omitempty"`
+	Reason            string  `json:"reason,omitempty"`
+	Members           int     `json:"members,omitempty"`
+	Source            string  `json:"source,omitempty"`
+	RequestConfidence float64 `json:"request_confidence,omitempty"`
+	URL               string  `json:"url"`
+}
+
+// Items lists the report's changes, additions first, grouped by category
+// with uncategorized ones last.
+func (r PlanReport) Items() []ReportItem {
+	var items []ReportItem
+	add := func(action string, subs []string) {
+		for _, sub := range subs {
+			items = append(items, ReportItem{
+				Action:            action,
+				Subreddit:         sub,
+				Category:          r.Plan.Categories[sub],
+				Reason:            r.Plan.Explanations[sub],
+				Members:           r.Members[sub],
+				Source:            r.Plan.Sources[sub],
+				RequestConfidence: r.Plan.RequestConfidence[sub],
+				URL:               SubredditURL(sub),
+			})
+		}
+	}
+	add("add", r.Plan.ToAdd)
+	add("remove", r.Plan.ToRemove)
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.Action != b.Action {
+			return a.Action == "add"
+		}
+		if a.Category != b.Category {
+			if a.Category == "" || b.Category == "" {
+				return b.Category == ""
+			}
+			return a.Category < b.Category
+		}
+		return strings.ToLower(a.Subreddit) < strings.ToLower(b.Subreddit)
+	})
+	return items
+}
+
+// SubredditURL links to a subreddit on Reddit.
+func SubredditURL(sub string) string {
+	return "https://www.reddit.com/r/" + strings.TrimPrefix(sub, "r/") + "/"
+}
+
+// FormatMembers shortens a subscriber count, such as 1234567 to "1.2M".
+func FormatMembers(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	}
+	return fmt.Sprint(n)
+}
+
+// Renderer writes a plan report in one output format.
+type Renderer interface {
+	Render(w io.Writer, report PlanReport) error
+}
+
+// NewRenderer returns the renderer for a format from ParseFormat.
+func NewRenderer(format string) (Renderer, error) {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatTerminal:
+		return TerminalRenderer{Color: true, Emoji: true}, nil
+	case FormatText:
+		return TerminalRenderer{}, nil
+	case FormatMarkdown:
+		return markdownRenderer{}, nil
+	case FormatHTML:
+		return htmlRenderer{}, nil
+	case FormatCSV:
+		return csvRenderer{}, nil
+	}
+	return jsonRenderer{}, nil
+}
+
+// RenderPlan writes report to w in the given format.
+func RenderPlan(w io.Writer, format string, report PlanReport) error {
+	r, err := NewRenderer(format)
+	if err != nil {
+		return err
+	}
+	return r.Render(w, report)
+}
+
+// TerminalRenderer writes the plan as the console shows it.
+type TerminalRenderer struct {
+	Color bool // ANSI colors
+	Emoji bool
+}
+
+// StdoutRenderer uses color and emoji only when stdout is a terminal and
+// NO_COLOR is unset, so piped output stays plain.
+func StdoutRenderer() TerminalRenderer {
+	tty := term.IsTerminal(int(os.Stdout.Fd()))
+	return TerminalRenderer{Color: tty && os.Getenv("NO_COLOR") == "", Emoji: tty}
+}
+
+const (
+	ansiGreen = "\033[32m"
+	ansiRed   = "\033[31m"
+	ansiDim   = "\033[2m"
+	ansiReset = "\033[0m"
+)
+
+func (t TerminalRenderer) Render(w io.Writer, report PlanReport) error {
+	plan := report.Plan
+	paint := func(color, s string) string {
+		if !t.Color {
+			return s
+		}
+		return color + s + ansiReset
+	}
+	section := func(title, emoji, sign, color string, subs []string) {
+		if len(subs) == 0 {
+			return
+		}
+		subs = append([]string(nil), subs...)
+		sort.Strings(subs)
+		if t.Emoji {
+			title = emoji + " " + title
+		}
+		fmt.Fprintln(w, title)
+		for _, sub := range subs {
+			line := paint(color, " "+sign+" "+sub)
+			if n, ok := report.Members[sub]; ok {
+				line += paint(ansiDim, " · "+FormatMembers(n))
+			}
+			if explanation := plan.Explanations[sub]; explanation != "" {
+				line += " (" + explanation + ")"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	if report.Title != "" {
+		fmt.Fprintln(w, report.Title)
+	}
+	section("To Add:", "➕", "+", ansiGreen, plan.ToAdd)
+	section("To Remove:", "➖", "-", ansiRed, plan.ToRemove)
+	if len(plan.ToAdd) == 0 && len(plan.ToRemove) == 0 {
+		if t.Emoji {
+			fmt.Fprintln(w, "✅ No changes needed.")
+		} else {
+			fmt.Fprintln(w, "= No changes needed.")
+		}
+	}
+	return nil
+}
+
+type markdownRenderer struct{}
+
+func (markdownRenderer) Render(w io.Writer, report PlanReport) error {
+	title := report.Title
+	if title == "" {
+		title = "Subreddit plan"
+	}
+	fmt.Fprintf(w, "# %s\n\n", title)
+	if meta := reportMeta(report.Meta); len(meta) > 0 {
+		fmt.Fprintf(w, "_%s_\n\n", strings.Join(meta, " · "))
+	}
+	for _, prompt := range report.Meta.Prompts {
+		fmt.Fprintf(w, "> %s\n", prompt)
+	}
+	if len(report.Meta.Prompts) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	items := report.Items()
+	if len(items) == 0 {
+		fmt.Fprintln(w, "No changes needed.")
+		return nil
+	}
+	categorized := hasCategories(items)
+	action, category := "", "-"
+	for _, it := range items {
+		if it.Action != action {
+			if action != "" {
+				fmt.Fprintln(w)
+			}
+			action, category = it.Action, "-"
+			fmt.Fprintf(w, "## %s (%d)\n", actionHeading(it.Action), countAction(items, it.Action))
+			if !categorized {
+				fmt.Fprintln(w)
+			}
+		}
+		if categorized && it.Category != category {
+			category = it.Category
+			fmt.Fprintf(w, "\n### %s\n\n", categoryName(category))
+		}
+		line := fmt.Sprintf("- [%s](%s)", it.Subreddit, it.URL)
+		if it.Members > 0 {
+			line += fmt.Sprintf(" · %s members", FormatMembers(it.Members))
+		}
+		if it.Reason != "" {
+			line += " – " + it.Reason
+		}
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+type htmlRenderer struct{}
+
+var reportTemplate = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"members":  FormatMembers,
+	"heading":  actionHeading,
+	"category": categoryName,
+}).ParseFS(reportTemplates, "templates/report.html"))
+
+type htmlSection struct {
+	Action string
+	Groups []htmlGroup
+}
+
+type htmlGroup struct {
+	Category string
+	Items    []ReportItem
+}
+
+func (htmlRenderer) Render(w io.Writer, report PlanReport) error {
+	var sections []htmlSection
+	for _, it := range report.Items() {
+		if len(sections) == 0 || sections[len(sections)-1].Action != it.Action {
+			sections = append(sections, htmlSection{Action: it.Action})
+		}
+		s := &sections[len(sections)-1]
+		if len(s.Groups) == 0 || s.Groups[len(s.Groups)-1].Category != it.Category {
+			s.Groups = append(s.Groups, htmlGroup{Category: it.Category})
+		}
+		g := &s.Groups[len(s.Groups)-1]
+		g.Items = append(g.Items, it)
+	}
+	title := report.Title
+	if title == "" {
+		title = "Subreddit plan"
+	}
+	return reportTemplate.Execute(w, map[string]any{
+		"Title":       title,
+		"Categorized": hasCategories(report.Items()),
+		"Meta":        reportMeta(report.Meta),
+		"Prompts":     report.Meta.Prompts,
+		"Sections":    sections,
+	})
+}
+
+type csvRenderer struct{}
+
+func (csvRenderer) Render(w io.Writer, report PlanReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"action", "subreddit", "category", "reason", "members", "source", "request_confidence", "url"})
+	for _, it := range report.Items() {
+		members, confidence := "", ""
+		if it.Members > 0 {
+			members = strconv.Itoa(it.Members)
+		}
+		if it.Source != "" {
+			confidence = strconv.FormatFloat(it.RequestConfidence, 'f', -1, 64)
+		}
+		cw.Write([]string{it.Action, it.Subreddit, it.Category, it.Reason, members, it.Source, confidence, it.URL})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(w io.Writer, report PlanReport) error {
+	out := struct {
+		Title         string       `json:"title,omitempty"`
+		CreatedAt     *time.Time   `json:"created_at,omitempty"`
+		Account       string       `json:"account,omitempty"`
+		Model         string       `json:"model,omitempty"`
+		PromptVersion string       `json:"prompt_version,omitempty"`
+		Prompts       []string     `json:"prompts,omitempty"`
+		Items         []ReportItem `json:"items"`
+	}{
+		Title:         report.Title,
+		Account:       report.Meta.Account,
+		Model:         report.Meta.Model,
+		PromptVersion: report.Meta.PromptVersion,
+		Prompts:       report.Meta.Prompts,
+		Items:         report.Items(),
+	}
+	if !report.Meta.CreatedAt.IsZero() {
+		out.CreatedAt = &report.Meta.CreatedAt
+	}
+	if out.Items == nil {
+		out.Items = []ReportItem{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// reportMeta describes where a plan came from in a few short phrases.
+func reportMeta(doc models.PlanDocument) []string {
+	var meta []string
+	if !doc.CreatedAt.IsZero() {
+		meta = append(meta, doc.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if doc.Account != "" {
+		meta = append(meta, "u/"+doc.Account)
+	}
+	if doc.Model != "" {
+		meta = append(meta, doc.Model)
+	}
+	if doc.PromptVersion != "" {
+		meta = append(meta, "prompts "+doc.PromptVersion)
+	}
+	return meta
+}
+
+func actionHeading(action string) string {
+	if action == "remove" {
+		return "To remove"
+	}
+	return "To add"
+}
+
+func categoryName(category string) string {
+	if category == "" {
+		return "Other"
+	}
+	return category
+}
+
+func hasCategories(items []ReportItem) bool {
+	for _, it := range items {
+		if it.Category != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func countAction(items []ReportItem, action string) int {
+	n := 0
+	for _, it := range items {
+		if it.Action == action {
+			n++
+		}
+	}
+	return n
+}
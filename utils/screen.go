@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// Key is one key press read by Screen. Printable keys have Rune set;
+// others are named, such as "up", "enter", "tab", "backtab", "esc",
+// "backspace", "delete", "home", "end", "pgup", "pgdn" and "ctrl-c".
+type Key struct {
+	Rune rune
+	Name string
+}
+
+// Text styles for Screen.Put.
+const (
+	StyleNone    = ""
+	StyleBold    = "\x1b[1m"
+	StyleDim     = "\x1b[2m"
+	StyleReverse = "\x1b[7m"
+	StyleGreen   = "\x1b[32m"
+	StyleRed     = "\x1b[31m"
+	StyleYellow  = "\x1b[33m"
+	StyleCyan    = "\x1b[36m"
+)
+
+// Screen drives a full-screen terminal UI on the alternate screen: the
+// terminal is put in raw mode, key presses arrive on Keys, and each frame is
+// drawn with Put and sent in one write by Flush.
+type Screen struct {
+	in    *os.File
+	out   *os.File
+	state *term.State
+	keys  chan Key
+	frame strings.Builder
+}
+
+// OpenScreen takes over the terminal. Call Close to give it back.
+func OpenScreen() (*Screen, error) {
+	in, out := os.Stdin, os.Stdout
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return nil, errors.New("the terminal UI needs an interactive terminal")
+	}
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	s := &Screen{in: in, out: out, state: state, keys: make(chan Key, 16)}
+	// Alternate screen, hidden cursor.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	go s.readKeys()
+	return s, nil
+}
+
+// Close restores the terminal.
+func (s *Screen) Close() {
+	fmt.Fprint(s.out, "\x1b[0m\x1b[?25h\x1b[?1049l")
+	term.Restore(int(s.in.Fd()), s.state)
+}
+
+// Keys delivers key presses. It is closed when input ends.
+func (s *Screen) Keys() <-chan Key {
+	return s.keys
+}
+
+// Size returns the terminal's width and height.
+func (s *Screen) Size() (width, height int) {
+	width, height, err := term.GetSize(int(s.out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// Put draws text at row and col (both from 0), cut or padded to width
+// columns.
+func (s *Screen) Put(row, col, width int, text, style string) {
+	if width <= 0 {
+		return
+	}
+	fmt.Fprintf(&s.frame, "\x1b[%d;%dH", row+1, col+1)
+	if style != StyleNone {
+		s.frame.WriteString(style)
+	}
+	s.frame.WriteString(Fit(text, width))
+	if style != StyleNone {
+		s.frame.WriteString("\x1b[0m")
+	}
+}
+
+// Cursor shows the cursor at row and col for the next frame, or hides it
+// when row is negative.
+func (s *Screen) Cursor(row, col int) {
+	if row < 0 {
+		s.frame.WriteString("\x1b[?25l")
+		return
+	}
+	fmt.Fprintf(&s.frame, "\x1b[%d;%dH\x1b[?25h", row+1, col+1)
+}
+
+// Flush clears the screen and draws everything Put since the last Flush.
+func (s *Screen) Flush() {
+	s.out.WriteString("\x1b[?25l\x1b[H\x1b[2J" + s.frame.String())
+	s.frame.Reset()
+}
+
+func (s *Screen) readKeys() {
+	defer close(s.keys)
+	r := bufio.NewReader(s.in)
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return
+		}
+		key := Key{Rune: c}
+		switch c {
+		case '\r', '\n':
+			key = Key{Name: "enter"}
+		case '\t':
+			key = Key{Name: "tab"}
+		case 127, 8:
+			key = Key{Name: "backspace"}
+		case 3:
+			key = Key{Name: "ctrl-c"}
+		case 4:
+			key = Key{Name: "ctrl-d"}
+		case 21:
+			key = Key{Name: "ctrl-u"}
+		case 27:
+			key = readEscape(r)
+		default:
+			if c < 32 {
+				continue
+			}
+		}
+		s.keys <- key
+	}
+}
+
+// readEscape decodes the sequence after ESC. Terminals send a sequence in
+// one write, so an ESC with nothing buffered after it is the Esc key.
+func readEscape(r *bufio.Reader) Key {
+	if r.Buffered() == 0 {
+		return Key{Name: "esc"}
+	}
+	c, _, _ := r.ReadRune()
+	if c != '[' && c != 'O' {
+		return Key{Name: "esc"}
+	}
+	c, _, _ = r.ReadRune()
+	switch c {
+	case 'A':
+		return Key{Name: "up"}
+	case 'B':
+		return Key{Name: "down"}
+	case 'C':
+		return Key{Name: "right"}
+	case 'D':
+		return Key{Name: "left"}
+	case 'H':
+		return Key{Name: "home"}
+	case 'F':
+		return Key{Name: "end"}
+	case 'Z':
+		return Key{Name: "backtab"}
+	}
+	// Sequences such as "\x1b[5~" end with "~".
+	seq := string(c)
+	for r.Buffered() > 0 {
+		c, _, _ = r.ReadRune()
+		if c == '~' {
+			break
+		}
+		seq += string(c)
+	}
+	names := map[string]string{
+		"1": "home", "7": "home", "4": "end", "8": "end",
+		"3": "delete", "5": "pgup", "6": "pgdn",
+	}
+	if name, ok := names[seq]; ok {
+		return Key{Name: name}
+	}
+	return Key{Name: "esc"}
+}
+
+// Fit cuts text to width terminal columns, ending it with "…" when cut,
+// and pads it with spaces to exactly width.
+func Fit(text string, width int) string {
+	if w := StringWidth(text); w <= width {
+		return text + strings.Repeat(" ", width-w)
+	}
+	var sb strings.Builder
+	used := 0
+	for _, r := range text {
+		if used+RuneWidth(r) > width-1 {
+			break
+		}
+		sb.WriteRune(r)
+		used += RuneWidth(r)
+	}
+	sb.WriteString("…")
+	return sb.String() + strings.Repeat(" ", width-used-1)
+}
+
+// StringWidth is how many terminal columns text takes up.
+func StringWidth(text string) int {
+	n := 0
+	for _, r := range text {
+		n += RuneWidth(r)
+	}
+	return n
+}
+
+// RuneWidth approximates how many columns r takes up: 0 for combining marks
+// and other invisible runes, 2 for East Asian wide characters and emoji, 1
+// otherwise.
+func RuneWidth(r rune) int {
+	switch {
+	case r == 0xFE0F || r == 0x200D || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Cf, r) || unicode.IsControl(r):
+		return 0
+	case r >= 0x1100 && r <= 0x115F,
+		r >= 0x2E80 && r <= 0xA4CF,
+		r >= 0xAC00 && r <= 0xD7A3,
+		r >= 0xF900 && r <= 0xFAFF,
+		r >= 0xFE30 && r <= 0xFE4F,
+		r >= 0xFF00 && r <= 0xFF60,
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F300 && r <= 0x1FAFF,
+		r >= 0x20000 && r <= 0x3FFFD:
+		return 2
+	}
+	return 1
+}
+
+// Wrap breaks text into lines of at most width columns, at spaces where
+// possible.
+func Wrap(text string, width int) []string {
+	if width <= 0 {
+		return nil
+	}
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		line, lineWidth := "", 0
+		for _, word := range strings.Fields(para) {
+			w := StringWidth(word)
+			for w > width {
+				// A word longer than the line is split.
+				cut, cutWidth := "", 0
+				for _, r := range word {
+					if cutWidth+RuneWidth(r) > width {
+						break
+					}
+					cut += string(r)
+					cutWidth += RuneWidth(r)
+				}
+				if cut == "" {
+					break
+				}
+				if line != "" {
+					lines = append(lines, line)
+					line, lineWidth = "", 0
+				}
+				lines = append(lines, cut)
+				word = word[len(cut):]
+				w = StringWidth(word)
+			}
+			if word == "" {
+				continue
+			}
+			switch {
+			case line == "":
+				line, lineWidth = word, w
+			case lineWidth+1+w <= width:
+				line += " " + word
+				lineWidth += 1 + w
+			default:
+				lines = append(lines, line)
+				line, lineWidth = word, w
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HenryArin/ReddmeitAlpha/models"
+)
+
+// SessionFile returns where the interactive session is autosaved.
+// REDDMEIT_SESSION_FILE overrides the default.
+func SessionFile() string {
+	if file := os.Getenv("REDDMEIT_SESSION_FILE"); file != "" {
+		return file
+	}
+	return filepath.Join(ConfigDir(), "session.json")
+}
+
+// PreviousSessionFile returns where RotateSessionState keeps the save it
+// replaces.
+func PreviousSessionFile() string {
+	file := SessionFile()
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".prev" + filepath.Ext(file)
+}
+
+// LoadSessionState reads the saved session. ok is false when there is none.
+func LoadSessionState() (state models.SessionState, ok bool, err error) {
+	return loadSessionFile(SessionFile())
+}
+
+// LoadPreviousSessionState reads the save set aside by RotateSessionState.
+func LoadPreviousSessionState() (state models.SessionState, ok bool, err error) {
+	return loadSessionFile(PreviousSessionFile())
+}
+
+func loadSessionFile(file string) (state models.SessionState, ok bool, err error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, false, fmt.Errorf("%s: %w", file, err)
+	}
+	return state, true, nil
+}
+
+// RotateSessionState moves the saved session to PreviousSessionFile,
+// replacing an older one there, so the next save doesn't overwrite it.
+func RotateSessionState() error {
+	err := os.Rename(SessionFile(), PreviousSessionFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SaveSessionState writes the session, replacing the file atomically so a
+// crash mid-write never leaves a truncated save behind.
+func SaveSessionState(state models.SessionState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := SessionFile()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// ClearSessionState deletes the saved session, if any.
+func ClearSessionState() error {
+	err := os.Remove(SessionFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var subredditNameRe = regexp.MustCompile(`^[A-Za-z0-9_]{1,21}$`)
+
+// NormalizeSubreddit accepts "r/name", "/r/name" or "name" and returns the
+// "r/name" form used in plans, or an error if it isn't a valid subreddit name.
+func NormalizeSubreddit(name string) (string, error) {
+	clean := strings.TrimSpace(name)
+	clean = strings.TrimPrefix(clean, "/")
+	if len(clean) > 2 && strings.EqualFold(clean[:2], "r/") {
+		clean = clean[2:]
+	}
+	clean = strings.TrimSuffix(clean, "/")
+	if !subredditNameRe.MatchString(clean) {
+		return "", fmt.Errorf("%q is not a valid subreddit name", name)
+	}
+	return "r/" + clean, nil
+}
+
+// SameSubreddit reports whether a and b name the same subreddit, ignoring
+// case and the r/ prefix.
+func SameSubreddit(a, b string) bool {
+	return strings.EqualFold(strings.TrimPrefix(a, "r/"), strings.TrimPrefix(b, "r/"))
+}
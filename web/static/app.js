@@ -0,0 +1,425 @@
+// Reddmeit dashboard. Everything goes through the JSON API served by
+// `reddmeit serve` on the same origin.
+"use strict";
+
+const state = {
+  items: [],          // the session plan's items
+  rejected: new Set(), // subreddits toggled off
+  info: new Map(),     // subreddit metadata, or a pending promise
+};
+
+// Each browser keeps its own session on the server.
+const sessionId = localStorage.getItem("reddmeit-session") || randomId();
+localStorage.setItem("reddmeit-session", sessionId);
+
+// `reddmeit serve` prints a link carrying its API key in the fragment, which
+// never reaches the server; keep the key and take it out of the address bar.
+if (location.hash.startsWith("#key=")) {
+  localStorage.setItem("reddmeit-api-key", decodeURIComponent(location.hash.slice(5)));
+  history.replaceState(null, "", location.pathname + location.search);
+}
+
+function randomId() {
+  const bytes = new Uint8Array(8);
+  crypto.getRandomValues(bytes);
+  return Array.from(bytes, (b) => b.toString(16).padStart(2, "0")).join("");
+}
+
+// el builds an element; strings become text nodes, so nothing is parsed as
+// HTML.
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs || {})) {
+    if (key === "class") node.className = value;
+    else if (key.startsWith("on")) node.addEventListener(key.slice(2), value);
+    else node.setAttribute(key, value);
+  }
+  for (const child of children.flat()) {
+    if (child === null || child === undefined || child === false) continue;
+    node.append(child instanceof Node ? child : String(child));
+  }
+  return node;
+}
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+function setStatus(text) {
+  $("status").textContent = text;
+}
+
+async function api(method, path, body, extraHeaders) {
+  const headers = { "X-Reddmeit-Session": sessionId, ...extraHeaders };
+  const key = localStorage.getItem("reddmeit-api-key");
+  if (key) headers.Authorization = "Bearer " + key;
+  // The server wants JSON on every change, even ones without a body.
+  if (method !== "GET") headers["Content-Type"] = "application/json";
+  const resp = await fetch(path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  if (resp.status === 401) {
+    const entered = prompt("This server needs its API key (REDDMEIT_API_KEY, or the one `reddmeit serve` printed):");
+    if (entered) {
+      localStorage.setItem("reddmeit-api-key", entered);
+      return api(method, path, body, extraHeaders);
+    }
+  }
+  return resp;
+}
+
+async function apiJSON(method, path, body) {
+  const resp = await api(method, path, body);
+  if (resp.status === 204) return null;
+  const data = await resp.json();
+  if (!resp.ok && resp.status !== 207) throw new Error(data.error || resp.statusText);
+  return data;
+}
+
+function formatMembers(n) {
+  if (n >= 1e6) return (n / 1e6).toFixed(1) + "M";
+  if (n >= 1e3) return (n / 1e3).toFixed(1) + "k";
+  return String(n);
+}
+
+function subredditURL(sub) {
+  return "https://www.reddit.com/" + sub + "/";
+}
+
+// ---- Chat ----
+
+function addMessage(kind, text) {
+  const node = el("div", { class: "message " + kind }, text);
+  $("messages").append(node);
+  node.scrollIntoView({ block: "end" });
+  return node;
+}
+
+async function sendPrompt(event) {
+  event.preventDefault();
+  const text = $("prompt").value.trim();
+  if (!text) return;
+  $("prompt").value = "";
+  addMessage("user", text);
+  const pending = addMessage("assistant", "Thinking…");
+  $("send").disabled = true;
+  try {
+    const resp = await apiJSON("POST", "/api/recommend", { prompt: text });
+    const suggestion = resp.suggestion || {};
+    const adds = (suggestion.to_add || []).length;
+    const removes = (suggestion.to_remove || []).length;
+    if (resp.view_only) {
+      pending.textContent = resp.reply || "(no reply)";
+    } else if (adds + removes === 0) {
+      pending.textContent = "No strong subreddit matches. Try rephrasing or being more specific?";
+    } else {
+      pending.textContent = describeSuggestion(suggestion);
+    }
+    showConflicts(resp.conflicts || []);
+    showPlan(resp.plan);
+  } catch (err) {
+    pending.className = "message error";
+    pending.textContent = err.message;
+  } finally {
+    $("send").disabled = false;
+  }
+}
+
+function describeSuggestion(plan) {
+  const lines = [];
+  for (const sub of plan.to_add || []) lines.push("+ " + sub + reasonSuffix(plan, sub));
+  for (const sub of plan.to_remove || []) lines.push("- " + sub + reasonSuffix(plan, sub));
+  return lines.join("\n");
+}
+
+function reasonSuffix(plan, sub) {
+  const reason = (plan.explanations || {})[sub];
+  return reason ? " – " + reason : "";
+}
+
+function showConflicts(conflicts) {
+  const box = $("conflicts");
+  box.replaceChildren();
+  for (const c of conflicts) {
+    const outcome = c.resolution ? "kept as " + c.resolution : "dropped";
+    box.append(el("p", { class: "conflict" },
+      `⚖️ ${c.subreddit}: was going to ${c.earlier}, new suggestion says ${c.later} → ${outcome}`));
+  }
+}
+
+// ---- Plan ----
+
+async function loadPlan() {
+  try {
+    showPlan(await apiJSON("GET", "/api/plan"));
+  } catch (err) {
+    setStatus(err.message);
+  }
+}
+
+function showPlan(doc) {
+  state.items = (doc && doc.items) || [];
+  for (const sub of [...state.rejected]) {
+    if (!state.items.some((it) => it.subreddit === sub)) state.rejected.delete(sub);
+  }
+  renderPlan();
+}
+
+function renderPlan() {
+  const box = $("plan");
+  box.replaceChildren();
+  if (state.items.length === 0) {
+    box.append(el("p", { class: "muted" }, "No changes yet. Ask for some recommendations."));
+    updateButtons();
+    return;
+  }
+  for (const action of ["add", "remove"]) {
+    const items = state.items.filter((it) => it.action === action);
+    if (items.length === 0) continue;
+    box.append(el("h3", { class: "action " + action },
+      (action === "add" ? "To add" : "To remove") + ` (${items.length})`));
+    for (const [category, group] of groupByCategory(items)) {
+      box.append(el("h4", { class: "category" }, category || "Other"));
+      for (const it of group) box.append(card(it));
+    }
+  }
+  updateButtons();
+}
+
+function groupByCategory(items) {
+  const groups = new Map();
+  for (const it of items) {
+    const key = it.category || "";
+    if (!groups.has(key)) groups.set(key, []);
+    groups.get(key).push(it);
+  }
+  return [...groups.entries()].sort(([a], [b]) => {
+    if (a === "" || b === "") return a === "" ? 1 : -1;
+    return a.localeCompare(b);
+  });
+}
+
+function card(it) {
+  const rejected = state.rejected.has(it.subreddit);
+  const meta = el("div", { class: "meta" }, "…");
+  const node = el("div", { class: "card" + (rejected ? " rejected" : "") },
+    el("div", { class: "toggle" },
+      el("button", {
+        class: rejected ? "secondary" : "",
+        title: "Accept",
+        onclick: () => { state.rejected.delete(it.subreddit); renderPlan(); },
+      }, "✓"),
+      el("button", {
+        class: rejected ? "" : "secondary",
+        title: "Reject",
+        onclick: () => { state.rejected.add(it.subreddit); renderPlan(); },
+      }, "✗")),
+    el("div", { class: "name" },
+      el("a", { href: subredditURL(it.subreddit), target: "_blank", rel: "noopener" }, it.subreddit),
+      it.source ? el("span", { class: "badge" }, it.source) : null,
+      it.request_confidence ? el("span", { class: "badge", title: "request confidence" }, Math.round(it.request_confidence * 100) + "%") : null),
+    it.reason ? el("div", { class: "reason" }, it.reason) : null,
+    meta);
+  fillMeta(meta, it.subreddit);
+  return node;
+}
+
+// fillMeta shows a subreddit's member count, title and description once
+// they have been looked up.
+async function fillMeta(node, sub) {
+  if (!state.info.has(sub)) {
+    state.info.set(sub, apiJSON("GET", "/api/subreddits/" + encodeURIComponent(sub.replace(/^r\//, "")))
+      .catch(() => null));
+  }
+  const info = await state.info.get(sub);
+  node.replaceChildren();
+  if (!info) {
+    node.append("No details found on Reddit.");
+    return;
+  }
+  node.append(formatMembers(info.subscribers) + " members");
+  if (info.over_18) node.append(el("span", { class: "badge nsfw" }, "NSFW"));
+  if (info.title) node.append(" · " + info.title);
+  if (info.description) {
+    const text = info.description.length > 160 ? info.description.slice(0, 157) + "…" : info.description;
+    node.append(el("div", {}, text));
+  }
+}
+
+function acceptedPlan() {
+  const plan = { to_add: [], to_remove: [], explanations: {}, categories: {}, sources: {}, request_confidence: {} };
+  for (const it of state.items) {
+    if (state.rejected.has(it.subreddit)) continue;
+    (it.action === "add" ? plan.to_add : plan.to_remove).push(it.subreddit);
+    if (it.reason) plan.explanations[it.subreddit] = it.reason;
+    if (it.category) plan.categories[it.subreddit] = it.category;
+    if (it.source) plan.sources[it.subreddit] = it.source;
+    if (it.request_confidence) plan.request_confidence[it.subreddit] = it.request_confidence;
+  }
+  return plan;
+}
+
+function updateButtons() {
+  const accepted = state.items.filter((it) => !state.rejected.has(it.subreddit)).length;
+  $("apply").disabled = accepted === 0;
+  $("dry-run").disabled = accepted === 0;
+  $("apply").textContent = accepted ? `Apply ${accepted} accepted` : "Apply accepted";
+}
+
+function setAll(rejected) {
+  state.rejected = new Set(rejected ? state.items.map((it) => it.subreddit) : []);
+  renderPlan();
+}
+
+async function dryRun() {
+  const box = $("results");
+  box.replaceChildren();
+  try {
+    const diff = await apiJSON("POST", "/api/apply", { plan: acceptedPlan(), dry_run: true });
+    box.append(el("h3", {}, "Dry run"));
+    for (const sub of diff.to_add) box.append(el("div", { class: "result ok" }, "+ would subscribe to " + sub));
+    for (const sub of diff.to_remove) box.append(el("div", { class: "result failed" }, "- would leave " + sub));
+    for (const sub of diff.already_subscribed || []) box.append(el("div", { class: "result skipped" }, "already subscribed to " + sub));
+    for (const sub of diff.not_subscribed || []) box.append(el("div", { class: "result skipped" }, "already not subscribed to " + sub));
+  } catch (err) {
+    box.append(el("div", { class: "result failed" }, err.message));
+  }
+}
+
+// apply drops the rejected changes from the session plan, then applies the
+// rest, showing each result as the server reports it.
+async function apply() {
+  const plan = acceptedPlan();
+  const count = plan.to_add.length + plan.to_remove.length;
+  if (!confirm(`Apply ${count} change(s) to your Reddit account?`)) return;
+
+  const box = $("results");
+  const bar = el("div");
+  const lines = el("div");
+  box.replaceChildren(el("h3", {}, "Applying…"), el("div", { class: "progress" }, bar), lines);
+  $("apply").disabled = true;
+
+  try {
+    await apiJSON("PUT", "/api/plan", plan);
+    const resp = await api("POST", "/api/apply", {}, { Accept: "application/x-ndjson" });
+    if (!resp.ok) throw new Error((await resp.json()).error || resp.statusText);
+
+    let total = count;
+    let done = 0;
+    await readLines(resp.body, (msg) => {
+      if (msg.total !== undefined) {
+        total = msg.total;
+      } else if (msg.done) {
+        box.firstChild.textContent = `Applied ${msg.applied} of ${msg.applied + msg.failed} change(s).`;
+      } else if (msg.subreddit) {
+        done++;
+        bar.style.width = (100 * done / Math.max(total, 1)) + "%";
+        lines.append(resultLine(msg));
+      }
+    });
+    state.rejected.clear();
+    await loadPlan();
+  } catch (err) {
+    lines.append(el("div", { class: "result failed" }, err.message));
+  } finally {
+    updateButtons();
+  }
+}
+
+function resultLine(r) {
+  const verb = r.action === "sub" ? "Subscribed to" : "Left";
+  if (r.ok) return el("div", { class: "result ok" }, `✓ ${verb} ${r.subreddit}`);
+  if (r.skipped) return el("div", { class: "result skipped" }, `⏭ Skipped ${r.subreddit}: ${r.error}`);
+  return el("div", { class: "result failed" }, `✗ ${r.subreddit}: ${r.error || "failed"}`);
+}
+
+// readLines calls onLine with each JSON line of a streamed response.
+async function readLines(body, onLine) {
+  const reader = body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = "";
+  for (;;) {
+    const { value, done } = await reader.read();
+    buffer += decoder.decode(value || new Uint8Array(), { stream: !done });
+    let idx;
+    while ((idx = buffer.indexOf("\n")) >= 0) {
+      const line = buffer.slice(0, idx).trim();
+      buffer = buffer.slice(idx + 1);
+      if (line) onLine(JSON.parse(line));
+    }
+    if (done) break;
+  }
+}
+
+async function clearPlan() {
+  if (!confirm("Clear the whole plan?")) return;
+  await apiJSON("DELETE", "/api/plan");
+  state.rejected.clear();
+  $("results").replaceChildren();
+  $("conflicts").replaceChildren();
+  await loadPlan();
+}
+
+// ---- Activity ----
+
+async function loadActivity() {
+  const box = $("activity");
+  box.replaceChildren(el("p", { class: "muted" }, "Loading your activity from Reddit…"));
+  try {
+    renderActivity(await apiJSON("GET", "/api/activity"));
+  } catch (err) {
+    box.replaceChildren(el("p", { class: "result failed" }, err.message));
+  }
+}
+
+function renderActivity(stats) {
+  const subscribed = stats.filter((s) => s.subscribed);
+  const active = subscribed.filter((s) => s.upvoted || s.commented);
+  const quiet = subscribed.filter((s) => !s.upvoted && !s.commented);
+  const visited = stats.filter((s) => !s.subscribed && (s.upvoted || s.commented));
+  const rows = [
+    ["Subscribed", subscribed.length, ""],
+    ["Upvoted in", stats.filter((s) => s.upvoted).length, "upvoted"],
+    ["Commented in", stats.filter((s) => s.commented).length, "commented"],
+    ["Subscribed & active", active.length, "commented"],
+    ["Subscribed, no activity", quiet.length, "quiet"],
+    ["Active, not subscribed", visited.length, "upvoted"],
+  ];
+  const max = Math.max(1, ...rows.map(([, n]) => n));
+
+  const bars = el("div", { class: "bars" });
+  for (const [label, n, kind] of rows) {
+    bars.append(
+      el("div", {}, label),
+      el("div", {}, el("div", { class: "bar " + kind, style: `width:${(100 * n) / max}%` })),
+      el("div", {}, String(n)));
+  }
+
+  const chips = (list) => el("div", { class: "chips" },
+    list.map((s) => el("a", { class: "chip", href: subredditURL("r/" + s.name), target: "_blank", rel: "noopener" }, "r/" + s.name)));
+
+  $("activity").replaceChildren(
+    bars,
+    el("h4", { class: "category" }, "Subscribed, no recent activity"),
+    quiet.length ? chips(quiet) : el("p", { class: "muted" }, "None."),
+    el("h4", { class: "category" }, "Active, not subscribed"),
+    visited.length ? chips(visited) : el("p", { class: "muted" }, "None."));
+}
+
+// ---- Start ----
+
+$("prompt-form").addEventListener("submit", sendPrompt);
+$("prompt").addEventListener("keydown", (event) => {
+  if (event.key === "Enter" && !event.shiftKey) sendPrompt(event);
+});
+$("accept-all").addEventListener("click", () => setAll(false));
+$("reject-all").addEventListener("click", () => setAll(true));
+$("dry-run").addEventListener("click", dryRun);
+$("apply").addEventListener("click", apply);
+$("clear").addEventListener("click", clearPlan);
+$("load-activity").addEventListener("click", loadActivity);
+
+setStatus("session " + sessionId);
+loadPlan();
@@ -0,0 +1,22 @@
+// Package web holds the dashboard served by `reddmeit serve`. The files
+// under static/ are embedded into the binary and talk only to the local
+// JSON API, so the dashboard needs nothing beyond localhost.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard's files.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // the embedded directory is always there
+	}
+	return http.FileServerFS(files)
+}